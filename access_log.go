@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogConfig sets the format of the access log, combined or json,
+// and where it's written: stdout, or a file rotated once it reaches
+// max_size megabytes, keeping max_backups old files. An empty format
+// disables the access log.
+type AccessLogConfig struct {
+	Format     string `toml:"format"`
+	File       string `toml:"file"`
+	MaxSize    int    `toml:"max_size"`
+	MaxBackups int    `toml:"max_backups"`
+}
+
+// accessEntry describes a request proxied to an application.
+type accessEntry struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remote_addr"`
+	Host       string    `json:"host"`
+	App        string    `json:"app"`
+	Upstream   string    `json:"upstream"`
+	Port       int       `json:"port,omitempty"`
+	Method     string    `json:"method"`
+	URI        string    `json:"uri"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	Duration   float64   `json:"duration"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// AccessLog writes an entry for each request proxied to an application.
+// A nil AccessLog writes nothing.
+type AccessLog struct {
+	mu     sync.Mutex
+	format string
+	w      io.Writer
+}
+
+func NewAccessLog(c AccessLogConfig) (*AccessLog, error) {
+	format := strings.ToLower(c.Format)
+	switch format {
+	case "":
+		return nil, nil
+	case "combined", "json":
+	default:
+		return nil, fmt.Errorf("Unknown access log format: %s", c.Format)
+	}
+
+	if c.File == "" || c.File == "stdout" {
+		return &AccessLog{format: format, w: os.Stdout}, nil
+	}
+
+	f, err := newRotatingFile(c.File, int64(c.MaxSize)*1024*1024, c.MaxBackups)
+	if err != nil {
+		return nil, err
+	}
+	return &AccessLog{format: format, w: f}, nil
+}
+
+func (l *AccessLog) Log(e *accessEntry) {
+	if l == nil {
+		return
+	}
+
+	var line []byte
+	if l.format == "json" {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return
+		}
+		line = append(b, '\n')
+	} else {
+		line = []byte(combinedLine(e))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.w.Write(line)
+	if err != nil {
+		log.Printf("ERROR: unable to write access log: %v\n", err)
+	}
+}
+
+// combinedLine formats e in the Apache combined log format, followed by
+// the host, app, upstream and duration in seconds.
+func combinedLine(e *accessEntry) string {
+	host, _, err := net.SplitHostPort(e.RemoteAddr)
+	if err != nil {
+		host = e.RemoteAddr
+	}
+
+	return fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s %q %q %q %s %s %.6f\n",
+		dash(host), e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method, e.URI, e.Proto, e.Status, bytesField(e.Bytes),
+		dash(e.Referer), dash(e.UserAgent),
+		e.Host, dash(e.App), dash(e.Upstream), e.Duration)
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func bytesField(n int64) string {
+	if n == 0 {
+		return "-"
+	}
+	return fmt.Sprint(n)
+}
+
+// statusWriter records the status and size of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// rotatingFile is a file renamed to file.1, file.1 to file.2 and so on,
+// once it reaches max bytes. A max of zero disables the rotation.
+type rotatingFile struct {
+	name    string
+	max     int64
+	backups int
+	f       *os.File
+	size    int64
+}
+
+func newRotatingFile(name string, max int64, backups int) (*rotatingFile, error) {
+	err := os.MkdirAll(path.Dir(name), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &rotatingFile{name: name, max: max, backups: backups}
+	return r, r.open()
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.f = f
+	r.size = info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if r.max > 0 && r.size > 0 && r.size+int64(len(p)) > r.max {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	r.f.Close()
+
+	if r.backups > 0 {
+		for i := r.backups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.name, i), fmt.Sprintf("%s.%d", r.name, i+1))
+		}
+		os.Rename(r.name, r.name+".1")
+	} else {
+		os.Remove(r.name)
+	}
+	return r.open()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, "hello")
+	}))
+	defer s.Close()
+
+	port := getServerPort(t, s.URL)
+	p := NewProxy(newAppCenter([]App{newApp("myapp", port)}), "local")
+
+	var out bytes.Buffer
+	p.Log(&AccessLog{format: "json", w: &out})
+
+	req := httptest.NewRequest("GET", "http://myapp.local/hi?x=1", nil)
+	req.Header.Set("User-Agent", "test")
+	p.ServeHTTP(httptest.NewRecorder(), req)
+
+	var e accessEntry
+	if err := json.Unmarshal(out.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Host != "myapp.local" || e.App != "myapp" || e.Port != port {
+		t.Errorf("Route: got %s %s %d; expected myapp.local myapp %d", e.Host, e.App, e.Port, port)
+	}
+
+	if e.Upstream != fmt.Sprint("localhost:", port) {
+		t.Errorf("Upstream: got %s", e.Upstream)
+	}
+
+	if e.Method != "GET" || e.URI != "/hi?x=1" || e.Status != http.StatusAccepted || e.Bytes != 5 {
+		t.Errorf("Entry: got %s %s %d %d; expected GET /hi?x=1 202 5", e.Method, e.URI, e.Status, e.Bytes)
+	}
+
+	if e.UserAgent != "test" || e.Duration <= 0 {
+		t.Errorf("Entry: got %+v", e)
+	}
+
+	out.Reset()
+	p.Log(&AccessLog{format: "combined", w: &out})
+	p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://myapp.local/hi", nil))
+
+	line := out.String()
+	expected := fmt.Sprintf("\"GET /hi HTTP/1.1\" 202 5 \"-\" \"-\" \"myapp.local\" myapp localhost:%d ", port)
+	if !strings.HasPrefix(line, "192.0.2.1 - - [") || !strings.Contains(line, expected) {
+		t.Errorf("Combined: got %s", line)
+	}
+}
+
+func TestNewAccessLog(t *testing.T) {
+	l, err := NewAccessLog(AccessLogConfig{})
+	if l != nil || err != nil {
+		t.Errorf("An empty format should disable the access log")
+	}
+	l.Log(&accessEntry{})
+
+	_, err = NewAccessLog(AccessLogConfig{Format: "xml"})
+	if err == nil {
+		t.Errorf("Unknown formats should be rejected")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bam-access-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := path.Join(dir, "logs", "access.log")
+	f, err := newRotatingFile(name, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{name, "fourth\n"},
+		{name + ".1", "third\n"},
+		{name + ".2", "second\n"},
+	}
+
+	for _, tt := range tests {
+		b, err := ioutil.ReadFile(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.expected {
+			t.Errorf("%s: got %q; expected %q", path.Base(tt.name), b, tt.expected)
+		}
+	}
+
+	if _, err := os.Stat(name + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Only 2 backups should be kept")
+	}
+}
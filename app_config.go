@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path"
+
+	"github.com/BurntSushi/toml"
+)
+
+// appConfigFile is the file, inside an application's directory, holding
+// the bam settings of that application.
+const appConfigFile = ".bam.toml"
+
+// AppConfig holds the per-application settings.
+type AppConfig struct {
+	Port      int            `toml:"port"`
+	Socket    bool           `toml:"socket"`
+	SocketEnv string         `toml:"socket_env"`
+	Web       string         `toml:"web"`
+	DependsOn []string       `toml:"depends_on"`
+	AutoStart *bool          `toml:"auto_start"`
+	Group     string         `toml:"group"`
+	Tags      []string       `toml:"tags"`
+	Formation map[string]int `toml:"formation"`
+	Hooks     Hooks          `toml:"hooks"`
+	Compose   ComposeConfig  `toml:"compose"`
+	Static    StaticConfig   `toml:"static"`
+	Limits    LimitsConfig   `toml:"limits"`
+}
+
+// defaultSocketEnv is the variable holding the socket path of applications
+// listening on unix sockets.
+const defaultSocketEnv = "SOCKET"
+
+// Hooks are shell commands run in the application's directory, with its
+// environment, at some points of its lifecycle.
+type Hooks struct {
+	BeforeStart string `toml:"before_start"`
+	AfterStart  string `toml:"after_start"`
+	BeforeStop  string `toml:"before_stop"`
+}
+
+// ComposeConfig names the Docker Compose service receiving the requests
+// and the container port it listens on.
+type ComposeConfig struct {
+	Service string `toml:"service"`
+	Port    int    `toml:"port"`
+}
+
+// LimitsConfig caps the resources used by the processes of an application.
+// Memory is a size like 512M or 2G, and CPU a percentage of a CPU core.
+type LimitsConfig struct {
+	Memory    string `toml:"memory"`
+	CPU       int    `toml:"cpu"`
+	OpenFiles int    `toml:"open_files"`
+}
+
+// StaticConfig sets how the files of a static site are served. Root is
+// the document root, relative to the application's directory. NotFound
+// is the page, relative to Root, served for missing files.
+type StaticConfig struct {
+	Root          string `toml:"root"`
+	SPA           bool   `toml:"spa"`
+	Listing       *bool  `toml:"listing"`
+	NotFound      string `toml:"not_found"`
+	CacheControl  string `toml:"cache_control"`
+	ETag          bool   `toml:"etag"`
+	Precompressed bool   `toml:"precompressed"`
+	LiveReload    bool   `toml:"live_reload"`
+}
+
+// listing reports whether directories without an index.html are listed,
+// which they are unless disabled.
+func (c StaticConfig) listing() bool {
+	return c.Listing == nil || *c.Listing
+}
+
+// parseAppConfig reads the settings of the application at dir. Applications
+// without a configuration file get the default settings.
+func parseAppConfig(dir string) (*AppConfig, error) {
+	c := &AppConfig{}
+	_, err := toml.DecodeFile(path.Join(dir, appConfigFile), c)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return c, nil
+}
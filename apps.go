@@ -3,10 +3,15 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/jweslley/localtunnel"
@@ -23,29 +28,145 @@ type App interface {
 	Stop() error
 
 	Running() bool
+
+	State() State
+}
+
+// State is a step of an application's lifecycle.
+type State int
+
+const (
+	Stopped State = iota
+	Starting
+	Running
+	Stopping
+	Crashed
+
+	// Down is the state of aliases which don't answer their health checks.
+	Down
+)
+
+var stateNames = []string{"stopped", "starting", "running", "stopping", "crashed", "down"}
+
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return fmt.Sprintf("State(%d)", s)
+	}
+	return stateNames[s]
 }
 
 var (
 	errAlreadyStarted = errors.New("Already started")
 	errNotStarted     = errors.New("Not started")
 	errAlreadyShared  = errors.New("Already shared")
+	errNotShareable   = errors.New("Only applications listening on a local port can be shared")
+	errShareCanceled  = errors.New("Sharing canceled")
 )
 
+// app holds the fields shared by all applications. ops serializes
+// Start and Stop calls while mu guards the fields read concurrently
+// by the proxy, HTTP handlers and monitoring goroutines.
 type app struct {
-	name string
-	port int
+	ops       sync.Mutex
+	mu        sync.RWMutex
+	name      string
+	port      int
+	state     State
+	events    *EventBus
+	allocator *PortAllocator
+	dependsOn []string
+	autoStart *bool
+	group     string
+	tags      []string
 }
 
 func (a *app) Name() string {
 	return a.name
 }
 
+// Dependencies returns the names of the applications which must be
+// running before this one starts.
+func (a *app) Dependencies() []string {
+	return a.dependsOn
+}
+
+// AutoStart tells whether the application starts along with bam, when
+// its settings say so.
+func (a *app) AutoStart() (start, set bool) {
+	if a.autoStart == nil {
+		return false, false
+	}
+	return *a.autoStart, true
+}
+
+// Group returns the group named in the application's settings.
+func (a *app) Group() string {
+	return a.group
+}
+
+// Tags returns the tags listed in the application's settings.
+func (a *app) Tags() []string {
+	return a.tags
+}
+
 func (a *app) Port() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 	return a.port
 }
 
+func (a *app) State() State {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.state
+}
+
+func (a *app) setState(s State) {
+	a.mu.Lock()
+	a.state = s
+	a.mu.Unlock()
+	a.notify(s)
+}
+
+// notify publishes the event matching a transition to s, if any.
+func (a *app) notify(s State) {
+	if t, ok := stateEvents[s]; ok {
+		a.publish(t, "")
+	}
+}
+
+func (a *app) publish(t EventType, data string) {
+	a.publishEvent(Event{Type: t, Data: data})
+}
+
+func (a *app) publishEvent(e Event) {
+	a.mu.RLock()
+	events := a.events
+	a.mu.RUnlock()
+	e.App = a.name
+	events.Publish(e)
+}
+
+func (a *app) setEventBus(b *EventBus) {
+	a.mu.Lock()
+	a.events = b
+	a.mu.Unlock()
+}
+
+func (a *app) setPortAllocator(pa *PortAllocator) {
+	a.mu.Lock()
+	a.allocator = pa
+	a.mu.Unlock()
+}
+
+func (a *app) portAllocator() *PortAllocator {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.allocator
+}
+
 func (a *app) String() string {
-	return fmt.Sprintf("%s:%d", a.name, a.port)
+	return fmt.Sprintf("%s:%d", a.name, a.Port())
 }
 
 type processApp struct {
@@ -53,57 +174,682 @@ type processApp struct {
 	dir       string
 	env       []string
 	processes map[string]string
-	process   procker.Process
+	formation map[string]int
+	web       string
+	fixedPort int
+	socketEnv string
+	hooks     Hooks
+	limits    limits
+	cgroup    *cgroup
+	limitKill string
+	process   *processGroup
+	ports     map[string]int
+	sockets   map[string]string
+	next      map[string]int
+	runEnv    []string
+	siblings  func() []App
+}
+
+// ProcessInfo describes a process of a Procfile and its running instances.
+type ProcessInfo struct {
+	Name      string
+	Count     int
+	Instances []InstanceInfo
+}
+
+// InstanceInfo describes a running instance of a process, like web.1,
+// listening either on Port or on Socket.
+type InstanceInfo struct {
+	Name   string
+	Port   int
+	Socket string
 }
 
 func (a *processApp) Start() error {
+	a.ops.Lock()
+	defer a.ops.Unlock()
+
 	if a.Running() {
 		return errAlreadyStarted
 	}
 
+	a.setState(Starting)
+	a.createCgroup()
 	p, err := a.buildProcess()
 	if err != nil {
+		a.removeCgroup()
+		a.setState(Stopped)
 		return err
 	}
 
+	err = a.runHook("before_start", a.hooks.BeforeStart)
+	if err != nil {
+		a.portAllocator().Release(a.name)
+		a.removeCgroup()
+		a.setState(Stopped)
+		return err
+	}
+
+	err = p.Start()
+	if err != nil {
+		a.portAllocator().Release(a.name)
+		a.removeCgroup()
+		a.setState(Crashed)
+		return err
+	}
+
+	a.mu.Lock()
 	a.process = p
-	return a.process.Start()
+	a.state = Running
+	a.mu.Unlock()
+
+	for _, instance := range p.list() {
+		go a.watch(p, instance)
+	}
+
+	if a.hooks.AfterStart == "" {
+		go a.announceReady(p)
+		return nil
+	}
+
+	err = waitReady(a, readyTimeout)
+	if err == nil {
+		err = a.runHook("after_start", a.hooks.AfterStart)
+	}
+	if err != nil {
+		a.abortStart(p)
+		return err
+	}
+	a.notify(Running)
+	return nil
 }
 
 func (a *processApp) Stop() error {
+	a.ops.Lock()
+	defer a.ops.Unlock()
+
 	if !a.Running() {
 		return errNotStarted
 	}
 
-	err := a.process.Stop(3 * time.Second) // FIXME magic number
+	a.mu.Lock()
+	p := a.process
+	a.state = Stopping
+	a.mu.Unlock()
+
+	err := a.runHook("before_stop", a.hooks.BeforeStop)
+	if err != nil {
+		log.Printf("WARN %s: %v\n", a.Name(), err)
+	}
+
+	return a.stopProcesses(p)
+}
+
+// abortStart stops the processes of p after a failed start, unless they
+// crashed already.
+func (a *processApp) abortStart(p *processGroup) {
+	a.mu.Lock()
+	current := a.process == p
+	if current {
+		a.state = Stopping
+	}
+	a.mu.Unlock()
+
+	if current {
+		a.stopProcesses(p)
+	}
+}
+
+// stopProcesses stops the processes of p and releases their resources.
+func (a *processApp) stopProcesses(p *processGroup) error {
+	err := p.Stop(3 * time.Second) // FIXME magic number
+	a.portAllocator().Release(a.name)
+	a.removeSockets()
+	a.removeCgroup()
+
+	a.mu.Lock()
 	a.process = nil
+	a.state = Stopped
+	a.mu.Unlock()
+	a.notify(Stopped)
 	return err
 }
 
 func (a *processApp) Running() bool {
-	return a.process != nil && a.process.Running()
+	return a.State() == Running
+}
+
+// State reports Crashed as soon as the processes exit on their own,
+// even before watch has recorded it.
+func (a *processApp) State() State {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.state == Running && !a.process.Running() {
+		return Crashed
+	}
+	return a.state
+}
+
+// announceReady publishes the ready event once the processes of g accept
+// connections, unless they are stopped or crash first.
+func (a *processApp) announceReady(g *processGroup) {
+	err := waitReady(a, readyTimeout)
+
+	a.mu.RLock()
+	current := a.process == g
+	a.mu.RUnlock()
+
+	if !current {
+		return
+	}
+
+	if err != nil {
+		log.Printf("WARN %s: %v\n", a.Name(), err)
+		return
+	}
+	a.notify(Running)
+}
+
+// watch waits for the instance p of group g to exit. An instance exiting
+// on its own crashes the application, stopping the remaining instances,
+// unless it was stopped through Stop or Scale.
+func (a *processApp) watch(g *processGroup, p *process) {
+	<-p.Done()
+
+	a.mu.Lock()
+	crashed := a.process == g && a.state == Running && g.contains(p)
+	if crashed {
+		a.process = nil
+		a.state = Crashed
+	}
+	a.mu.Unlock()
+
+	if !crashed {
+		return
+	}
+
+	g.Stop(3 * time.Second) // FIXME magic number
+	a.portAllocator().Release(a.name)
+	a.removeSockets()
+
+	a.mu.RLock()
+	cg := a.cgroup
+	a.mu.RUnlock()
+	ooms := 0
+	if cg != nil {
+		ooms = cg.ooms()
+	}
+	a.removeCgroup()
+
+	code := p.ExitCode()
+	data := fmt.Sprintf("%s exited with code %d", p.name, code)
+	signal, _ := p.Signal()
+	if kill := a.limits.explainKill(signal, ooms, cg); kill != "" {
+		a.mu.Lock()
+		a.limitKill = fmt.Sprintf("%s: %s.", p.name, kill)
+		a.mu.Unlock()
+		data = fmt.Sprintf("%s: %s", data, kill)
+	}
+
+	a.publishEvent(Event{
+		Type:     EventCrashed,
+		Data:     data,
+		ExitCode: &code,
+	})
+}
+
+// Limits describes the resource limits of the processes.
+func (a *processApp) Limits() string {
+	return a.limits.String()
 }
 
-func (a *processApp) buildProcess() (procker.Process, error) {
-	port, err := FreePort()
+// LimitKill explains why the application was killed the last time it
+// crashed, if it went over its limits.
+func (a *processApp) LimitKill() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.limitKill
+}
+
+// createCgroup creates the cgroup limiting the memory and CPU of the
+// processes. Without cgroups, the limits are applied through rlimits.
+func (a *processApp) createCgroup() {
+	a.mu.Lock()
+	a.limitKill = ""
+	a.mu.Unlock()
+
+	if a.limits.memory == 0 && a.limits.cpu == 0 {
+		return
+	}
+
+	cg, err := newCgroup(a.name, a.limits)
 	if err != nil {
+		log.Printf("WARN %s: limiting with rlimits, as cgroups are unavailable: %v\n", a.Name(), err)
+		if a.limits.cpu > 0 {
+			log.Printf("WARN %s: the cpu limit requires cgroups, ignoring it\n", a.Name())
+		}
+	}
+
+	a.mu.Lock()
+	a.cgroup = cg
+	a.mu.Unlock()
+}
+
+func (a *processApp) removeCgroup() {
+	a.mu.Lock()
+	cg := a.cgroup
+	a.cgroup = nil
+	a.mu.Unlock()
+
+	if cg != nil {
+		if err := cg.remove(); err != nil {
+			log.Printf("WARN %s: %v\n", a.Name(), err)
+		}
+	}
+}
+
+// Scale sets the number of instances of the named process, starting or
+// stopping instances right away if the application is running. If an
+// instance fails to start, the instances started meanwhile are stopped
+// and the number of instances is kept.
+func (a *processApp) Scale(name string, count int) error {
+	a.ops.Lock()
+	defer a.ops.Unlock()
+
+	if _, ok := a.processes[name]; !ok {
+		return fmt.Errorf("Process %s not found", name)
+	}
+
+	if count < 0 || (count == 0 && name == a.webProcess()) {
+		return fmt.Errorf("Invalid number of %s instances: %d", name, count)
+	}
+
+	a.mu.Lock()
+	current := a.formation[name]
+	g := a.process
+	running := a.state == Running
+	if !running {
+		a.formation[name] = count
+	}
+	a.mu.Unlock()
+
+	if !running {
+		return nil
+	}
+
+	for i := current + 1; i <= count; i++ {
+		err := a.startInstance(g, name, i)
+		if err != nil {
+			for j := i - 1; j > current; j-- {
+				a.stopInstance(g, instanceName(name, j))
+			}
+			return err
+		}
+	}
+
+	for i := current; i > count; i-- {
+		a.stopInstance(g, instanceName(name, i))
+	}
+
+	a.mu.Lock()
+	a.formation[name] = count
+	a.mu.Unlock()
+	return nil
+}
+
+func (a *processApp) startInstance(g *processGroup, name string, i int) error {
+	instance := instanceName(name, i)
+	port, socket := 0, ""
+	if a.socketEnv != "" {
+		socket = a.socketPath(instance)
+	} else {
+		var err error
+		port, err = a.allocatePort(name, i)
+		if err != nil {
+			return err
+		}
+	}
+
+	a.mu.Lock()
+	if socket != "" {
+		a.sockets[instance] = socket
+	} else {
+		a.ports[instance] = port
+	}
+	env := a.runEnv
+	a.mu.Unlock()
+
+	p := a.newProcess(name, i, env)
+	err := p.Start()
+	if err != nil {
+		a.portAllocator().ReleasePort(port)
+		return err
+	}
+
+	g.add(p)
+	go a.watch(g, p)
+	return nil
+}
+
+func (a *processApp) stopInstance(g *processGroup, instance string) {
+	p := g.remove(instance)
+	if p != nil {
+		p.Stop(3 * time.Second) // FIXME magic number
+	}
+
+	a.mu.Lock()
+	port := a.ports[instance]
+	socket := a.sockets[instance]
+	delete(a.ports, instance)
+	delete(a.sockets, instance)
+	a.mu.Unlock()
+
+	if socket != "" {
+		os.Remove(socket)
+	} else {
+		a.portAllocator().ReleasePort(port)
+	}
+}
+
+// ProcessPort returns the port of a running instance of the named process,
+// or of the web process if name is empty, rotating among the instances.
+func (a *processApp) ProcessPort(name string) (int, bool) {
+	if a.socketEnv != "" {
+		return 0, false
+	}
+
+	instance, ok := a.nextInstance(name)
+	if !ok {
+		return 0, false
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.ports[instance], true
+}
+
+// ProcessSocket is like ProcessPort for applications listening on unix
+// sockets, returning the socket path of an instance.
+func (a *processApp) ProcessSocket(name string) (string, bool) {
+	if a.socketEnv == "" {
+		return "", false
+	}
+
+	instance, ok := a.nextInstance(name)
+	if !ok {
+		return "", false
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.sockets[instance], true
+}
+
+// nextInstance returns the name of the next running instance of the named
+// process, or of the web process if name is empty.
+func (a *processApp) nextInstance(name string) (string, bool) {
+	if name == "" {
+		name = a.webProcess()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.process == nil {
+		return "", false
+	}
+
+	instances := a.process.running(name)
+	if len(instances) == 0 {
+		return "", false
+	}
+
+	i := a.next[name] % len(instances)
+	a.next[name] = i + 1
+	return instances[i].name, true
+}
+
+// Processes describes the formation of the application and, while it is
+// running, the instances of each process.
+func (a *processApp) Processes() []ProcessInfo {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	processes := []ProcessInfo{}
+	for _, name := range a.processNames() {
+		info := ProcessInfo{Name: name, Count: a.formation[name]}
+		if a.process != nil {
+			for _, p := range a.process.running(name) {
+				info.Instances = append(info.Instances, InstanceInfo{
+					Name:   p.name,
+					Port:   a.ports[p.name],
+					Socket: a.sockets[p.name],
+				})
+			}
+		}
+		processes = append(processes, info)
+	}
+	return processes
+}
+
+// Pids returns the ids of the running instances of the processes.
+func (a *processApp) Pids() []int {
+	a.mu.RLock()
+	g := a.process
+	a.mu.RUnlock()
+
+	pids := []int{}
+	if g == nil {
+		return pids
+	}
+
+	for _, p := range g.list() {
+		if pid := p.Pid(); pid > 0 && p.Running() {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// processNames returns the names of the processes of the Procfile, sorted.
+func (a *processApp) processNames() []string {
+	names := []string{}
+	for name := range a.processes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// webProcess returns the name of the process receiving the proxied
+// requests: the configured one, the one named web or the first one.
+func (a *processApp) webProcess() string {
+	if a.web != "" {
+		return a.web
+	}
+
+	if _, ok := a.processes["web"]; ok {
+		return "web"
+	}
+	return a.processNames()[0]
+}
+
+// instanceName names the i-th instance of a process, like web.1.
+func instanceName(process string, i int) string {
+	return fmt.Sprintf("%s.%d", process, i)
+}
+
+func (a *processApp) allocatePort(name string, i int) (int, error) {
+	fixed := 0
+	if name == a.webProcess() && i == 1 {
+		fixed = a.fixedPort
+	}
+	return a.portAllocator().Allocate(a.name, instanceName(name, i), fixed)
+}
+
+func (a *processApp) buildProcess() (*processGroup, error) {
+	a.mu.RLock()
+	formation := make(map[string]int, len(a.formation))
+	for name, count := range a.formation {
+		formation[name] = count
+	}
+	a.mu.RUnlock()
+
+	ports := make(map[string]int)
+	sockets := make(map[string]string)
+	for name := range a.processes {
+		for i := 1; i <= formation[name]; i++ {
+			instance := instanceName(name, i)
+			if a.socketEnv != "" {
+				sockets[instance] = a.socketPath(instance)
+				continue
+			}
+
+			port, err := a.allocatePort(name, i)
+			if err != nil {
+				a.portAllocator().Release(a.name)
+				return nil, err
+			}
+			ports[instance] = port
+		}
+	}
+
+	if a.socketEnv != "" {
+		err := os.MkdirAll(socketDir(), 0700)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	a.mu.Lock()
+	a.ports = ports
+	a.sockets = sockets
+	a.port = ports[instanceName(a.webProcess(), 1)]
+	a.next = make(map[string]int)
+	a.mu.Unlock()
+
+	env, err := a.environ()
+	if err != nil {
+		a.portAllocator().Release(a.name)
 		return nil, err
 	}
 
-	a.port = port
-	p := []procker.Process{}
-	for name, command := range a.processes {
-		prefix := fmt.Sprintf("[%s:%s] ", a.Name(), name)
-		process := &procker.SysProcess{
-			Command: command,
-			Dir:     a.dir,
-			Env:     append(a.env, fmt.Sprintf("PORT=%d", port)),
-			Stdout:  procker.NewPrefixedWriter(os.Stdout, prefix),
-			Stderr:  procker.NewPrefixedWriter(os.Stderr, prefix),
+	a.mu.Lock()
+	a.runEnv = env
+	a.mu.Unlock()
+
+	p := newProcessGroup()
+	for name := range a.processes {
+		for i := 1; i <= formation[name]; i++ {
+			p.add(a.newProcess(name, i, env))
 		}
-		p = append(p, process)
 	}
-	return procker.NewProcessGroup(p...), nil
+	return p, nil
+}
+
+// newProcess creates the i-th instance of the named process, which gets
+// its own PORT, or socket, and its instance name in PS, like foreman does.
+func (a *processApp) newProcess(name string, i int, env []string) *process {
+	instance := instanceName(name, i)
+	prefix := fmt.Sprintf("[%s:%s] ", a.Name(), instance)
+	a.mu.RLock()
+	setup := a.limits.setup(a.cgroup)
+	a.mu.RUnlock()
+	return &process{
+		name:    instance,
+		kind:    name,
+		command: a.processes[name],
+		setup:   setup,
+		dir:     a.dir,
+		env:     withEnv(env, a.listenEnv(instance), "PS="+instance),
+		stdout:  a.output(os.Stdout, prefix, instance),
+		stderr:  a.output(os.Stderr, prefix, instance),
+	}
+}
+
+// listenEnv returns the variable telling instance where to listen: PORT,
+// or the configured socket variable.
+func (a *processApp) listenEnv(instance string) string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.socketEnv != "" {
+		return fmt.Sprintf("%s=%s", a.socketEnv, a.sockets[instance])
+	}
+	return fmt.Sprintf("PORT=%d", a.ports[instance])
+}
+
+// socketPath returns the path of the unix socket of instance. Stale
+// sockets left behind by a previous run are removed.
+func (a *processApp) socketPath(instance string) string {
+	socket := path.Join(socketDir(), fmt.Sprintf("%s.%s.sock", a.name, instance))
+	os.Remove(socket)
+	return socket
+}
+
+// removeSockets removes the unix sockets of the application, if any.
+func (a *processApp) removeSockets() {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, socket := range a.sockets {
+		os.Remove(socket)
+	}
+}
+
+// environ returns the environment of the application's processes and
+// hooks: the addresses of the sibling applications, the .env variables,
+// with {{app "name"}} references resolved, and PORT or the socket of
+// the web process.
+func (a *processApp) environ() ([]string, error) {
+	a.mu.RLock()
+	siblings := a.siblings
+	a.mu.RUnlock()
+
+	apps := []App{}
+	if siblings != nil {
+		apps = siblings()
+	}
+
+	env, err := expandEnv(a.env, apps)
+	if err != nil {
+		return nil, err
+	}
+
+	env = append(discoveryEnv(a.Name(), apps), env...)
+	return append(env, a.listenEnv(instanceName(a.webProcess(), 1))), nil
+}
+
+// withEnv returns a copy of env with vars appended.
+func withEnv(env []string, vars ...string) []string {
+	e := make([]string, 0, len(env)+len(vars))
+	e = append(e, env...)
+	return append(e, vars...)
+}
+
+func (a *processApp) setSiblings(siblings func() []App) {
+	a.mu.Lock()
+	a.siblings = siblings
+	a.mu.Unlock()
+}
+
+// runHook runs the named hook command, if any, publishing its output as
+// log events.
+func (a *processApp) runHook(name, command string) error {
+	a.mu.RLock()
+	env := a.runEnv
+	a.mu.RUnlock()
+
+	prefix := fmt.Sprintf("[%s:%s] ", a.Name(), name)
+	return runHook(name, command, a.dir, env, a.output(os.Stdout, prefix, name))
+}
+
+// output returns a writer copying the output of the named process to w
+// and publishing it as log events.
+func (a *app) output(w io.Writer, prefix, name string) io.Writer {
+	return io.MultiWriter(
+		procker.NewPrefixedWriter(w, prefix),
+		newLogWriter(func(t EventType, line string) {
+			a.publish(t, fmt.Sprintf("%s: %s", name, line))
+		}))
 }
 
 func NewProcessApp(procfile string) (App, error) {
@@ -120,8 +866,53 @@ func NewProcessApp(procfile string) (App, error) {
 		env = []string{}
 	}
 
-	a := &processApp{dir: dir, env: env, processes: processes}
+	c, err := parseAppConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := processes[c.Web]; c.Web != "" && !ok {
+		return nil, fmt.Errorf("Process %s not found in %s", c.Web, procfile)
+	}
+
+	formation := make(map[string]int, len(processes))
+	for name := range processes {
+		formation[name] = 1
+	}
+
+	for name, count := range c.Formation {
+		if _, ok := processes[name]; !ok || count < 0 {
+			return nil, fmt.Errorf("Invalid formation %s=%d for %s", name, count, procfile)
+		}
+		formation[name] = count
+	}
+
+	if c.Socket && c.Port > 0 {
+		return nil, fmt.Errorf("Both port and socket set for %s", procfile)
+	}
+
+	l, err := parseLimits(c.Limits)
+	if err != nil {
+		return nil, fmt.Errorf("%v in %s", err, path.Join(dir, appConfigFile))
+	}
+
+	a := &processApp{dir: dir, env: env, processes: processes, formation: formation,
+		web: c.Web, fixedPort: c.Port, hooks: c.Hooks, limits: l}
+	if c.Socket {
+		a.socketEnv = c.SocketEnv
+		if a.socketEnv == "" {
+			a.socketEnv = defaultSocketEnv
+		}
+	}
+	if a.formation[a.webProcess()] < 1 {
+		return nil, fmt.Errorf("Process %s must have at least one instance in %s", a.webProcess(), procfile)
+	}
+
 	a.name = name
+	a.dependsOn = c.DependsOn
+	a.autoStart = c.AutoStart
+	a.group = c.Group
+	a.tags = c.Tags
 	return a, nil
 }
 
@@ -153,31 +944,66 @@ func parseEnv(filepath string) ([]string, error) {
 	return env, nil
 }
 
+// aliasApp gives a name to a local port used by an application not
+// managed by bam. While started, it's probed every interval and reported
+// as Down when it doesn't answer.
 type aliasApp struct {
 	app
-	running bool
+	network  string
+	address  string
+	health   string
+	base     *url.URL
+	client   *http.Client
+	interval time.Duration
+	done     chan struct{}
 }
 
-func (a *aliasApp) Start() error {
-	a.running = true
-	return nil
+func NewAliasApp(name string, port int) App {
+	a := &aliasApp{}
+	a.name = name
+	a.port = port
+	a.state = Running
+	a.init("tcp", fmt.Sprintf("localhost:%d", port),
+		&url.URL{Scheme: "http", Host: fmt.Sprintf("localhost:%d", port)}, http.DefaultTransport)
+	return a
 }
 
-func (a *aliasApp) Stop() error {
-	a.running = false
-	return nil
+// upstreamApp is an alias for an application not listening on a local port.
+type upstreamApp struct {
+	aliasApp
+	upstream  *url.URL
+	transport http.RoundTripper
 }
 
-func (a *aliasApp) Running() bool {
-	return a.running
-}
+// NewUpstreamApp creates an alias for the application at rawurl, which may
+// be on another host (http://10.0.0.5:8080, https://staging.example.com)
+// or on a unix socket (unix:///tmp/app.sock). TLS certificates of https
+// upstreams aren't verified if skipVerify is set.
+func NewUpstreamApp(name, rawurl string, skipVerify bool) (App, error) {
+	u, err := parseUpstream(rawurl)
+	if err != nil {
+		return nil, err
+	}
 
-func NewAliasApp(name string, port int) App {
-	a := &aliasApp{}
+	a := &upstreamApp{upstream: u, transport: newUpstreamTransport(u, skipVerify)}
 	a.name = name
-	a.port = port
-	a.running = true
-	return a
+	a.state = Running
+
+	network, address := upstreamAddr(u)
+	base := &url.URL{Scheme: u.Scheme, Host: u.Host}
+	if u.Scheme == "unix" {
+		base = &url.URL{Scheme: "http", Host: "localhost"}
+	}
+	a.init(network, address, base, a.transport)
+	return a, nil
+}
+
+func (a *upstreamApp) Upstream() *url.URL {
+	return a.upstream
+}
+
+func (a *upstreamApp) Transport() http.RoundTripper {
+	return a.transport
 }
 
 type webApp struct {
@@ -187,86 +1013,260 @@ type webApp struct {
 }
 
 func (a *webApp) Start() error {
+	a.ops.Lock()
+	defer a.ops.Unlock()
+
 	if a.Running() {
 		return errAlreadyStarted
 	}
 
-	l, err := NewLocalListener()
+	a.setState(Starting)
+	l, err := a.listen()
 	if err != nil {
+		a.setState(Stopped)
 		return err
 	}
 
 	port, err := AddrPort(l.Addr().String())
 	if err != nil {
+		l.Close()
+		a.portAllocator().Release(a.name)
+		a.setState(Stopped)
 		return err
 	}
 
+	if w, ok := a.handler.(watcher); ok {
+		w.watch()
+	}
+
+	a.mu.Lock()
 	a.listener = l
 	a.port = port
+	a.state = Running
+	a.mu.Unlock()
+	a.notify(Running)
 
 	s := &http.Server{Handler: a.handler}
 	go func() {
-		s.Serve(a.listener)
-		a.listener = nil
+		s.Serve(l)
+
+		a.mu.Lock()
+		crashed := a.listener == l
+		if crashed {
+			a.listener = nil
+			a.state = Crashed
+		}
+		a.mu.Unlock()
+
+		if crashed {
+			a.portAllocator().Release(a.name)
+			a.notify(Crashed)
+		}
 	}()
 
 	return nil
 }
 
 func (a *webApp) Stop() error {
+	a.ops.Lock()
+	defer a.ops.Unlock()
+
 	if !a.Running() {
 		return errNotStarted
 	}
 
-	err := a.listener.Close()
+	a.mu.Lock()
+	l := a.listener
 	a.listener = nil
+	a.state = Stopping
+	a.mu.Unlock()
+
+	err := l.Close()
+	a.portAllocator().Release(a.name)
+	if w, ok := a.handler.(watcher); ok {
+		w.unwatch()
+	}
+	a.setState(Stopped)
 	return err
 }
 
+// listen opens the application's listener on the port given by the
+// PortAllocator or, without one, on any free port.
+func (a *webApp) listen() (net.Listener, error) {
+	allocator := a.portAllocator()
+	if allocator == nil {
+		return NewLocalListener()
+	}
+
+	port, err := allocator.Allocate(a.name, "", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		allocator.Release(a.name)
+		return nil, err
+	}
+	return l, nil
+}
+
 func (a *webApp) Running() bool {
-	return a.listener != nil
+	return a.State() == Running
 }
 
-func NewWebServerApp(dir string) App {
+// NewWebServerApp creates a static site serving the files of dir, or of
+// its configured document root.
+func NewWebServerApp(dir string) (App, error) {
+	c, err := parseAppConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+
 	a := &webApp{}
 	a.name = path.Base(dir)
-	a.handler = http.StripPrefix("/", http.FileServer(http.Dir(dir)))
+	a.autoStart = c.AutoStart
+	a.group = c.Group
+	a.tags = c.Tags
+	a.handler = newStaticHandler(path.Join(dir, c.Static.Root), c.Static)
+	return a, nil
+}
+
+// unwrap returns the application wrapped by a ShareableApp.
+func unwrap(a App) App {
+	if s, ok := a.(*ShareableApp); ok {
+		return s.App
+	}
 	return a
 }
 
+// ShareableApp is an App which can be shared to the Internet through
+// localtunnel. It is safe for concurrent use: ops serializes Start, Stop
+// and Restart, so that a restart isn't interleaved with other calls.
 type ShareableApp struct {
 	App
-	tunnel *localtunnel.Tunnel
+	ops     sync.Mutex
+	mu      sync.RWMutex
+	tunnel  *localtunnel.Tunnel
+	pending *localtunnel.Tunnel // being opened by Share
+	events  *EventBus
+}
+
+func (a *ShareableApp) Start() error {
+	a.ops.Lock()
+	defer a.ops.Unlock()
+	return a.App.Start()
 }
 
 func (a *ShareableApp) Stop() error {
-	if a.Shared() {
-		go func() { a.Unshare() }()
+	a.ops.Lock()
+	defer a.ops.Unlock()
+
+	if t := a.takeTunnel(); t != nil {
+		go t.Close()
 	}
 
 	return a.App.Stop()
 }
 
+// Restart starts the dependencies of the application with
+// startDependencies, and then stops the application and starts it again.
+// A shared application keeps its tunnel when it gets its port back, since
+// the tunnel forwards to that port, and is shared again otherwise.
+func (a *ShareableApp) Restart(startDependencies func() error) error {
+	err := startDependencies()
+	if err != nil {
+		return err
+	}
+
+	shared, err := a.restart()
+	if err != nil || !shared || a.Shared() {
+		return err
+	}
+
+	err = waitReady(a, readyTimeout)
+	if err != nil {
+		return err
+	}
+	return a.Share()
+}
+
+// restart stops and starts the application as a single operation, closing
+// its tunnel unless it gets its port back, and tells whether it was shared.
+func (a *ShareableApp) restart() (shared bool, err error) {
+	a.ops.Lock()
+	defer a.ops.Unlock()
+
+	shared, port := a.Shared(), a.Port()
+	err = a.App.Stop()
+	if err != nil && err != errNotStarted {
+		return shared, err
+	}
+
+	err = a.App.Start()
+	if err != nil || a.Port() != port {
+		if t := a.takeTunnel(); t != nil {
+			go t.Close()
+		}
+	}
+	return shared, err
+}
+
+// Share opens a tunnel to the application. The tunnel is opened without
+// holding the lock, so that readers aren't blocked by the tunnel server,
+// and discarded if the application is unshared or stopped meanwhile.
 func (a *ShareableApp) Share() error {
 	if !a.Running() {
 		return errNotStarted
 	}
 
-	if a.Shared() {
+	a.mu.Lock()
+	if a.tunnel != nil || a.pending != nil {
+		a.mu.Unlock()
 		return errAlreadyShared
 	}
 
-	tunnel := localtunnel.DefaultClient.NewLocalTunnel(a.Port())
+	port := a.Port()
+	if port <= 0 {
+		a.mu.Unlock()
+		return errNotShareable
+	}
+
+	tunnel := localtunnel.DefaultClient.NewLocalTunnel(port)
+	a.pending = tunnel
+	a.mu.Unlock()
+
 	err := tunnel.Open()
+
+	a.mu.Lock()
+	canceled := a.pending != tunnel
+	if !canceled {
+		a.pending = nil
+	}
+	if err == nil && !canceled {
+		a.tunnel = tunnel
+	}
+	a.mu.Unlock()
+
 	if err != nil {
 		return err
 	}
 
-	a.tunnel = tunnel
+	if canceled {
+		go tunnel.Close()
+		return errShareCanceled
+	}
+
+	a.events.Publish(Event{Type: EventShared, App: a.Name(), Data: tunnel.URL()})
 
 	go func() {
 		<-tunnel.Closing()
-		a.tunnel = nil
+		a.mu.Lock()
+		if a.tunnel == tunnel {
+			a.tunnel = nil
+		}
+		a.mu.Unlock()
+		a.events.Publish(Event{Type: EventUnshared, App: a.Name()})
 	}()
 
 	return nil
@@ -277,18 +1277,33 @@ func (a *ShareableApp) Unshare() error {
 		return errNotStarted
 	}
 
-	if a.Shared() {
-		a.tunnel.Close()
+	if t := a.takeTunnel(); t != nil {
+		t.Close()
 	}
 
 	return nil
 }
 
+// takeTunnel detaches the current tunnel, if any, from the application,
+// canceling a tunnel being opened.
+func (a *ShareableApp) takeTunnel() *localtunnel.Tunnel {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t := a.tunnel
+	a.tunnel = nil
+	a.pending = nil
+	return t
+}
+
 func (a *ShareableApp) Shared() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 	return a.tunnel != nil
 }
 
 func (a *ShareableApp) URL() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 	if a.tunnel == nil {
 		return ""
 	}
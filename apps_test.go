@@ -2,7 +2,13 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -19,7 +25,11 @@ func TestApps(t *testing.T) {
 		apps = append(apps, fs)
 	}
 
-	apps = append(apps, NewWebServerApp("./examples/static"))
+	static, err := NewWebServerApp("./examples/static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apps = append(apps, static)
 
 	var wg sync.WaitGroup
 	for _, app := range apps {
@@ -34,15 +44,18 @@ func TestApps(t *testing.T) {
 
 			err := a.Start()
 			if err != nil {
-				t.Fatalf("Unable to start %s: %v", a.Name(), err)
+				t.Errorf("Unable to start %s: %v", a.Name(), err)
+				return
 			}
 
 			if !a.Running() {
-				t.Fatalf("app should be started now: %s", a.Name())
+				t.Errorf("app should be started now: %s", a.Name())
+				return
 			}
 
 			if a.Port() == 0 {
-				t.Fatalf("Port should not be zeroed: %s", a.Name())
+				t.Errorf("Port should not be zeroed: %s", a.Name())
+				return
 			}
 
 			<-time.After(1 * time.Second) // wait for start
@@ -50,7 +63,8 @@ func TestApps(t *testing.T) {
 			req, _ := http.NewRequest("GET", fmt.Sprintf("http://localhost:%d", a.Port()), nil)
 			res, err := http.DefaultClient.Do(req)
 			if err != nil {
-				t.Fatalf("Server unavailable %s: %v", a.Name(), err)
+				t.Errorf("Server unavailable %s: %v", a.Name(), err)
+				return
 			}
 
 			if res.StatusCode != 200 {
@@ -59,7 +73,8 @@ func TestApps(t *testing.T) {
 
 			a.Stop()
 			if a.Running() {
-				t.Fatalf("app should NOT be started now: %s", a.Name())
+				t.Errorf("app should NOT be started now: %s", a.Name())
+				return
 			}
 
 		}(app)
@@ -67,3 +82,396 @@ func TestApps(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestAppState(t *testing.T) {
+	a, err := NewWebServerApp("./examples/static")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.State() != Stopped {
+		t.Fatalf("State: got %s; expected %s", a.State(), Stopped)
+	}
+
+	const n = 10
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() { errs <- a.Start() }()
+	}
+
+	started := 0
+	for i := 0; i < n; i++ {
+		if err := <-errs; err == nil {
+			started++
+		} else if err != errAlreadyStarted {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+
+	if started != 1 {
+		t.Errorf("Concurrent starts: got %d; expected 1", started)
+	}
+
+	if a.State() != Running {
+		t.Errorf("State: got %s; expected %s", a.State(), Running)
+	}
+
+	for i := 0; i < n; i++ {
+		go func() { errs <- a.Stop() }()
+	}
+
+	stopped := 0
+	for i := 0; i < n; i++ {
+		if err := <-errs; err == nil {
+			stopped++
+		}
+	}
+
+	if stopped != 1 {
+		t.Errorf("Concurrent stops: got %d; expected 1", stopped)
+	}
+
+	if a.State() != Stopped {
+		t.Errorf("State: got %s; expected %s", a.State(), Stopped)
+	}
+}
+
+// newTestProcessApp creates a processApp in a temporary directory
+// from the given files contents.
+func newTestProcessApp(t *testing.T, files map[string]string) (App, string) {
+	dir := newTestDir(t, files)
+	a, err := NewProcessApp(path.Join(dir, "Procfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, dir
+}
+
+func TestProcessAppCrash(t *testing.T) {
+	a, dir := newTestProcessApp(t, map[string]string{
+		"Procfile": "web: sleep 0.2; exit 3\n",
+	})
+	defer os.RemoveAll(dir)
+
+	bus := NewEventBus()
+	events := bus.Subscribe()
+	defer bus.Unsubscribe(events)
+	a.(eventSource).setEventBus(bus)
+
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			if e.Type != EventCrashed {
+				continue
+			}
+
+			if e.ExitCode == nil || *e.ExitCode != 3 {
+				t.Errorf("Exit code: got %v; expected 3", e.ExitCode)
+			}
+
+			if a.State() != Crashed {
+				t.Errorf("State: got %s; expected %s", a.State(), Crashed)
+			}
+			return
+
+		case <-timeout:
+			t.Fatal("Crash not detected")
+		}
+	}
+}
+
+func TestProcessAppReady(t *testing.T) {
+	fileserver, _ := filepath.Abs("./examples/fileserver/fileserver")
+	a, dir := newTestProcessApp(t, map[string]string{
+		"Procfile": fmt.Sprintf("web: sleep 0.5; %s -p $PORT\n", fileserver),
+	})
+	defer os.RemoveAll(dir)
+
+	bus := NewEventBus()
+	events := bus.Subscribe()
+	defer bus.Unsubscribe(events)
+	a.(eventSource).setEventBus(bus)
+
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Stop()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			if e.Type != EventReady {
+				continue
+			}
+
+			conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", a.Port()))
+			if err != nil {
+				t.Fatalf("Ready before accepting connections: %v", err)
+			}
+			conn.Close()
+			return
+
+		case <-timeout:
+			t.Fatal("Ready event not published")
+		}
+	}
+}
+
+func TestProcessAppHooks(t *testing.T) {
+	fileserver, _ := filepath.Abs("./examples/fileserver/fileserver")
+	a, dir := newTestProcessApp(t, map[string]string{
+		"Procfile": fmt.Sprintf("web: %s -p $PORT\n", fileserver),
+		".env":     "GREETING=hello\n",
+		".bam.toml": `
+[hooks]
+before_start = "echo $GREETING > before_start"
+after_start = "echo $PORT > after_start"
+before_stop = "touch before_stop"
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	a.Stop()
+
+	content, _ := ioutil.ReadFile(path.Join(dir, "before_start"))
+	if string(content) != "hello\n" {
+		t.Errorf("before_start hook output: got %q; expected %q", content, "hello\n")
+	}
+
+	content, _ = ioutil.ReadFile(path.Join(dir, "after_start"))
+	if string(content) != fmt.Sprintf("%d\n", a.Port()) {
+		t.Errorf("after_start hook output: got %q; expected port %d", content, a.Port())
+	}
+
+	if _, err := os.Stat(path.Join(dir, "before_stop")); err != nil {
+		t.Errorf("before_stop hook not run: %v", err)
+	}
+}
+
+func TestProcessAppFailingHook(t *testing.T) {
+	a, dir := newTestProcessApp(t, map[string]string{
+		"Procfile":  "web: sleep 10\n",
+		".bam.toml": "[hooks]\nbefore_start = \"echo migration failed; exit 1\"\n",
+	})
+	defer os.RemoveAll(dir)
+
+	err := a.Start()
+	if err == nil {
+		a.Stop()
+		t.Fatal("A failing before_start hook should block the start")
+	}
+
+	if !strings.Contains(err.Error(), "migration failed") {
+		t.Errorf("Error should contain the hook output: %v", err)
+	}
+
+	if a.State() != Stopped {
+		t.Errorf("State: got %s; expected %s", a.State(), Stopped)
+	}
+}
+
+func TestProcessAppFailingAfterStartHook(t *testing.T) {
+	fileserver, _ := filepath.Abs("./examples/fileserver/fileserver")
+	a, dir := newTestProcessApp(t, map[string]string{
+		"Procfile":  fmt.Sprintf("web: %s -p $PORT\n", fileserver),
+		".bam.toml": "[hooks]\nafter_start = \"echo seeding failed; exit 1\"\n",
+	})
+	defer os.RemoveAll(dir)
+
+	err := a.Start()
+	if err == nil {
+		a.Stop()
+		t.Fatal("A failing after_start hook should block the start")
+	}
+
+	if _, ok := err.(*hookError); !ok || !strings.Contains(err.Error(), "seeding failed") {
+		t.Errorf("Error should be the hook failure: %v", err)
+	}
+
+	if a.State() != Stopped {
+		t.Errorf("State: got %s; expected %s", a.State(), Stopped)
+	}
+}
+
+func TestProcessAppPorts(t *testing.T) {
+	a, dir := newTestProcessApp(t, map[string]string{
+		"Procfile":  "api: echo $PORT > $PS.port; sleep 10\nworker: echo $PORT > $PS.port; sleep 10\n",
+		".bam.toml": "web = \"api\"\n",
+	})
+	defer os.RemoveAll(dir)
+
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Stop()
+
+	ports := instancePorts(a)
+	if ports["api.1"] == ports["worker.1"] {
+		t.Errorf("Processes should not share ports: %v", ports)
+	}
+
+	if a.Port() != ports["api.1"] {
+		t.Errorf("Port: got %d; expected the api port %d", a.Port(), ports["api.1"])
+	}
+
+	<-time.After(500 * time.Millisecond) // wait for processes to write their ports
+
+	for name, port := range ports {
+		content, _ := ioutil.ReadFile(path.Join(dir, name+".port"))
+		if string(content) != fmt.Sprintf("%d\n", port) {
+			t.Errorf("PORT of %s: got %q; expected %d", name, content, port)
+		}
+	}
+}
+
+func TestProcessAppSocket(t *testing.T) {
+	runtimeDir, err := ioutil.TempDir("", "bam-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(runtimeDir)
+	defer os.Setenv("XDG_RUNTIME_DIR", os.Getenv("XDG_RUNTIME_DIR"))
+	os.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+
+	a, dir := newTestProcessApp(t, map[string]string{
+		"Procfile":  "web: echo $BIND > $PS.bind; touch $BIND; sleep 10\n",
+		".bam.toml": "socket = true\nsocket_env = \"BIND\"\n",
+	})
+	defer os.RemoveAll(dir)
+
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	socket, ok := a.(processSocketer).ProcessSocket("")
+	expected := path.Join(runtimeDir, "bam", path.Base(dir)+".web.1.sock")
+	if !ok || socket != expected {
+		t.Errorf("Socket: got %s; expected %s", socket, expected)
+	}
+
+	if a.Port() != 0 {
+		t.Errorf("Port: got %d; expected no port", a.Port())
+	}
+
+	<-time.After(500 * time.Millisecond) // wait for the process to write its socket
+
+	content, _ := ioutil.ReadFile(path.Join(dir, "web.1.bind"))
+	if string(content) != expected+"\n" {
+		t.Errorf("BIND: got %q; expected %s", content, expected)
+	}
+
+	a.Stop()
+	if _, err := os.Stat(expected); !os.IsNotExist(err) {
+		t.Errorf("Socket %s should be removed on stop", expected)
+	}
+}
+
+func TestProcessAppScale(t *testing.T) {
+	a, dir := newTestProcessApp(t, map[string]string{
+		"Procfile":  "web: sleep 10\nworker: sleep 10\n",
+		".bam.toml": "[formation]\nweb = 2\nworker = 0\n",
+	})
+	defer os.RemoveAll(dir)
+
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Stop()
+
+	pa := a.(*processApp)
+	checkInstances := func(expected ...string) {
+		ports := instancePorts(a)
+		if len(ports) != len(expected) {
+			t.Errorf("Instances: got %v; expected %v", ports, expected)
+		}
+		for _, name := range expected {
+			if _, ok := ports[name]; !ok {
+				t.Errorf("Instance %s not running: %v", name, ports)
+			}
+		}
+	}
+
+	checkInstances("web.1", "web.2")
+
+	first, _ := pa.ProcessPort("")
+	second, _ := pa.ProcessPort("")
+	if first == second {
+		t.Errorf("Requests should be balanced between web instances: %d, %d", first, second)
+	}
+
+	if err := pa.Scale("worker", 2); err != nil {
+		t.Fatal(err)
+	}
+	checkInstances("web.1", "web.2", "worker.1", "worker.2")
+
+	if err := pa.Scale("web", 1); err != nil {
+		t.Fatal(err)
+	}
+	checkInstances("web.1", "worker.1", "worker.2")
+
+	if !a.Running() {
+		t.Error("Scaling down should not crash the application")
+	}
+
+	if err := pa.Scale("web", 0); err == nil {
+		t.Error("Web process should not be scaled to zero")
+	}
+}
+
+func TestProcessAppScaleFailure(t *testing.T) {
+	a, dir := newTestProcessApp(t, map[string]string{
+		"Procfile":  "web: sleep 10\nworker: sleep 10\n",
+		".bam.toml": "[formation]\nworker = 0\n",
+	})
+	defer os.RemoveAll(dir)
+
+	min, err := FreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.(portAware).setPortAllocator(NewPortAllocator(min, min+1, ""))
+
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Stop()
+
+	pa := a.(*processApp)
+	if err := pa.Scale("worker", 2); err == nil {
+		t.Fatal("Scaling beyond the port range should fail")
+	}
+
+	if ports := instancePorts(a); len(ports) != 1 {
+		t.Errorf("Instances started by a failed scale should be stopped: %v", ports)
+	}
+
+	for _, p := range pa.Processes() {
+		if p.Name == "worker" && p.Count != 0 {
+			t.Errorf("Worker instances: got %d; expected 0", p.Count)
+		}
+	}
+
+	if err := pa.Scale("worker", 1); err != nil {
+		t.Error(err)
+	}
+}
+
+// instancePorts returns the ports of the running instances of a, by name.
+func instancePorts(a App) map[string]int {
+	ports := make(map[string]int)
+	for _, p := range processes(a) {
+		for _, i := range p.Instances {
+			ports[i.Name] = i.Port
+		}
+	}
+	return ports
+}
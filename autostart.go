@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// autoStarter is implemented by applications whose own settings may tell
+// whether they start along with bam.
+type autoStarter interface {
+	AutoStart() (start, set bool)
+}
+
+// parseAutoStart returns the name patterns of the applications started
+// along with bam, given either as a bool, for all or none of them, or as
+// a list of patterns.
+func parseAutoStart(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		if v {
+			return []string{"*"}, nil
+		}
+		return nil, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		patterns := []string{}
+		for _, p := range v {
+			s, ok := p.(string)
+			if !ok {
+				return nil, fmt.Errorf("Invalid auto_start pattern: %v", p)
+			}
+			patterns = append(patterns, s)
+		}
+		return patterns, nil
+	}
+	return nil, fmt.Errorf("Invalid auto_start: %v", v)
+}
+
+// matchAny reports whether name matches any of patterns, like shop-*,
+// ignoring case.
+func matchAny(patterns []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(p), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// autoStarts reports whether a starts along with bam: as its own settings
+// say or, without them, if its name matches the auto_start patterns.
+// Aliases are probed as soon as they are loaded, so they never are.
+func (cc *CommandCenter) autoStarts(a *ShareableApp) bool {
+	if isAlias(a) {
+		return false
+	}
+	if s, ok := unwrap(a).(autoStarter); ok {
+		if start, set := s.AutoStart(); set {
+			return start
+		}
+	}
+	return matchAny(cc.autoStart, a.Name())
+}
+
+// autoStartApps returns the applications starting along with bam.
+func (cc *CommandCenter) autoStartApps() []*ShareableApp {
+	apps := []*ShareableApp{}
+	for _, app := range cc.Apps() {
+		if cc.autoStarts(app) {
+			apps = append(apps, app)
+		}
+	}
+	return apps
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseAutoStart(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected []string
+	}{
+		{nil, nil},
+		{false, nil},
+		{true, []string{"*"}},
+		{[]interface{}{"api", "shop-*"}, []string{"api", "shop-*"}},
+	}
+
+	for _, tt := range tests {
+		patterns, err := parseAutoStart(tt.value)
+		if err != nil || fmt.Sprint(patterns) != fmt.Sprint(tt.expected) {
+			t.Errorf("%v: got %v (%v); expected %v", tt.value, patterns, err, tt.expected)
+		}
+	}
+
+	for _, v := range []interface{}{"yes", int64(1), []interface{}{"api", 1}} {
+		if _, err := parseAutoStart(v); err == nil {
+			t.Errorf("%v: expected an error", v)
+		}
+	}
+}
+
+func TestAutoStart(t *testing.T) {
+	c := &Config{AppsDir: "./examples/", Tld: "app", AutoStart: true}
+	cc := NewCommandCenter("bam", c)
+
+	a, dir := newTestProcessApp(t, map[string]string{
+		"Procfile":  "web: sleep 10\n",
+		".bam.toml": "auto_start = false\n",
+	})
+	defer os.RemoveAll(dir)
+	cc.register(a)
+
+	b, dir := newTestProcessApp(t, map[string]string{
+		"Procfile":  "web: sleep 10\n",
+		".bam.toml": "auto_start = true\n",
+	})
+	defer os.RemoveAll(dir)
+	cc.register(b)
+	cc.register(NewAliasApp("pinger", 8888))
+
+	expected := map[string]bool{"fileserver": true, "ping": true, "static": true, "pyserver": true, "pinger": false}
+	expected[a.Name()] = false
+	expected[b.Name()] = true
+
+	for name, start := range expected {
+		app, _ := cc.app(name)
+		if cc.autoStarts(app) != start {
+			t.Errorf("%s: auto start %v; expected %v", name, !start, start)
+		}
+	}
+
+	cc.autoStart, _ = parseAutoStart([]interface{}{"P*"})
+	started := []string{}
+	for _, app := range cc.autoStartApps() {
+		started = append(started, app.Name())
+	}
+
+	if fmt.Sprint(started) != fmt.Sprintf("[%s ping PyServer]", b.Name()) {
+		t.Errorf("Auto started: got %v", started)
+	}
+}
+
+func TestStartGroup(t *testing.T) {
+	c := &Config{
+		AppsDir:     "./examples/",
+		Tld:         "app",
+		StartGroups: map[string][]string{"site": {"stat*"}, "nothing": {"missing"}},
+	}
+	cc := NewCommandCenter("bam", c)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		cc.handler.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		return w
+	}
+
+	w := postAction(cc, "/groups/site/start")
+	if w.Code != http.StatusFound {
+		t.Fatalf("Status code: got %d; expected %d", w.Code, http.StatusFound)
+	}
+
+	static, _ := cc.app("static")
+	defer static.Stop()
+	if !static.Running() {
+		t.Errorf("The applications of the start group should be started")
+	}
+
+	for _, target := range []string{"/groups/nothing/start", "/groups/unknown/start"} {
+		if w := postAction(cc, target); w.Code != http.StatusInternalServerError {
+			t.Errorf("%s: got %d; expected %d", target, w.Code, http.StatusInternalServerError)
+		}
+	}
+
+	if w := postAction(cc, "/groups/site/share"); w.Code != http.StatusNotFound {
+		t.Errorf("Status code: got %d; expected %d", w.Code, http.StatusNotFound)
+	}
+
+	if w := get("/"); !strings.Contains(w.Body.String(), "/groups/site/start") {
+		t.Errorf("Index should list the start groups")
+	}
+}
@@ -20,11 +20,19 @@ const programVersion = "0.1.0"
 var configTemplates = make(map[string]string)
 
 type Config struct {
-	AppsDir   string         `toml:"apps_dir"`
-	Tld       string         `toml:"tld"`
-	AutoStart bool           `toml:"auto_start"`
-	ProxyPort int            `toml:"proxy_port"`
-	Aliases   map[string]int `toml:"aliases"`
+	AppsDir     string                 `toml:"apps_dir"`
+	Tld         string                 `toml:"tld"`
+	AutoStart   interface{}            `toml:"auto_start"`
+	StartGroups map[string][]string    `toml:"start_groups"`
+	Tags        map[string][]string    `toml:"tags"`
+	Restore     bool                   `toml:"restore"`
+	ProxyPort   int                    `toml:"proxy_port"`
+	PortRange   []int                  `toml:"port_range"`
+	DataDir     string                 `toml:"data_dir"`
+	Aliases     map[string]interface{} `toml:"aliases"`
+	Notify      NotifyConfig           `toml:"notify"`
+	Inspector   InspectorConfig        `toml:"inspector"`
+	AccessLog   AccessLogConfig        `toml:"access_log"`
 }
 
 func parseConfig(file string) *Config {
@@ -38,6 +46,10 @@ func parseConfig(file string) *Config {
 		fail(err)
 	}
 
+	if c.DataDir == "" {
+		c.DataDir = defaultDataDir()
+	}
+
 	return c
 }
 
@@ -67,6 +79,7 @@ func main() {
 	versionFlag := flag.Bool("v", false, "print version information and exit")
 	configFlag := flag.String("config", "", "use a configuration file")
 	generateFlag := flag.String("generate", "", "generate configuration file(s). Use 'bam -generate help' to show generate options.")
+	eventsFlag := flag.Bool("events", false, "print the application events of a running bam and exit")
 
 	flag.Usage = usage
 	flag.Parse()
@@ -83,8 +96,20 @@ func main() {
 		return
 	}
 
+	if *eventsFlag {
+		addr := fmt.Sprintf("localhost:%d", cfg.ProxyPort)
+		fail(watchEvents(os.Stdout, addr, fmt.Sprintf("%s.%s", programName, cfg.Tld)))
+		return
+	}
+
 	log.SetPrefix("[bam] ")
 	cc := NewCommandCenter(programName, cfg)
+	if cfg.Notify.Enabled() {
+		go NewNotifier(cfg.Notify).Listen(cc.events)
+	}
+	go cc.metrics.Listen(cc.events)
+	go cc.usage.Run(usageInterval)
+
 	go func() {
 		log.Printf("Starting CommandCenter at %s\n", cc.rootURL())
 		fail(cc.Start())
@@ -119,6 +144,11 @@ func main() {
 	}()
 
 	proxy := NewProxy(cc, cfg.Tld)
+	proxy.Inspect(cc.inspector)
+	proxy.Measure(cc.metrics)
+	accessLog, err := NewAccessLog(cfg.AccessLog)
+	fail(err)
+	proxy.Log(accessLog)
 	log.Println("Starting Proxy at", proxyAddr)
 	s := http.Server{Handler: proxy}
 	s.Serve(l)
@@ -132,14 +162,67 @@ apps_dir = "."
 # tld is the top-level domain for local applications.
 tld = "dev"
 
-# Automatically starts all applications found on startup if set as true.
+# auto_start starts applications along with bam: all of them if set as true,
+# or the ones matching a list of name patterns, like ["api", "shop-*"].
+# Applications may also set auto_start in their .bam.toml, which prevails.
 auto_start = false
 
+# start_groups are named sets of applications, given by name patterns,
+# which can be started at once from the command center.
+#[start_groups]
+#shop-stack = ["shop-*", "redis"]
+
+# tags label applications, given by name patterns, in the command center.
+# Applications can also list their tags, and name their group, in their
+# .bam.toml; otherwise they're grouped by the folder holding them.
+#[tags]
+#backend = ["*-api", "redis"]
+
+# restore starts the applications which were running when bam was stopped,
+# on the same ports, sharing the ones which were shared. auto_start
+# applications are started after them.
+restore = false
+
 # proxy_port is the port where all :80 connections will be forwarded to before reaching any of the applications.
 proxy_port = 42042
 
-# aliases maps names for local ports used by applications not managed by bam.
+# port_range restricts the ports assigned to applications. By default any free port is used.
+# Applications get their last port back whenever it is free.
+#port_range = [5000, 5999]
+
+# data_dir is where bam keeps its state. Defaults to $XDG_DATA_HOME/bam or ~/.local/share/bam.
+#data_dir = "/home/me/.local/share/bam"
+
+# notify reports application events through desktop notifications (desktop = true)
+# and/or by running a command with BAM_APP, BAM_EVENT, BAM_MESSAGE and BAM_EXIT_CODE
+# set in its environment.
+[notify]
+desktop = false
+command = ""
+events = ["crashed", "ready"]
+
+# inspector keeps the last requests of each application, with bodies up to
+# max_body bytes, to be browsed in the command center. Set requests = 0 to disable it.
+[inspector]
+requests = 100
+max_body = 65536
+
+# access_log writes an entry for each proxied request, in the combined or json
+# format, to stdout or to a file rotated once it reaches max_size megabytes.
+# Leave format empty to disable it.
+[access_log]
+format = ""
+file = "stdout"
+max_size = 10
+max_backups = 5
+
+# aliases maps names for applications not managed by bam: a local port, an
+# upstream URL (http, https or unix socket) or a table with port or url,
+# skip_verify, and the health path and interval used to probe it.
 #[aliases]
 #btsync = 8080
 #transmission = 9091
+#vm = "http://192.168.56.10:3000"
+#docs = "unix:///run/docs.sock"
+#staging-api = { url = "https://staging-api.example.com", skip_verify = true, health = "/healthz", interval = "10s" }
 `
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// cgroupRoot is where the cgroup v2 hierarchy is mounted.
+const cgroupRoot = "/sys/fs/cgroup"
+
+var errNoCgroup = errors.New("No cgroup v2 delegated to bam")
+
+// cgroup is a cgroup v2 holding the processes of an application.
+type cgroup struct {
+	dir string
+}
+
+var delegated struct {
+	once sync.Once
+	dir  string
+	err  error
+}
+
+// delegatedCgroup returns the directory of the cgroup of BAM!, when it's
+// writable and offers the memory and cpu controllers to its children.
+// As cgroup v2 only enables controllers for the children of cgroups
+// without processes, BAM! moves itself into a leaf cgroup if needed.
+func delegatedCgroup() (string, error) {
+	delegated.once.Do(func() {
+		delegated.dir, delegated.err = findDelegatedCgroup()
+	})
+	return delegated.dir, delegated.err
+}
+
+func findDelegatedCgroup() (string, error) {
+	b, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", errNoCgroup
+	}
+
+	dir := ""
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			dir = path.Join(cgroupRoot, line[3:])
+		}
+	}
+	if dir == "" {
+		return "", errNoCgroup
+	}
+
+	b, err = ioutil.ReadFile(path.Join(dir, "cgroup.controllers"))
+	if err != nil {
+		return "", err
+	}
+
+	controllers := " " + strings.TrimSpace(string(b)) + " "
+	if !strings.Contains(controllers, " memory ") || !strings.Contains(controllers, " cpu ") {
+		return "", fmt.Errorf("Controllers memory and cpu unavailable in %s", dir)
+	}
+
+	enable := func() error {
+		return writeCgroupFile(dir, "cgroup.subtree_control", "+memory +cpu")
+	}
+
+	if err := enable(); err != nil {
+		leaf := path.Join(dir, "bam")
+		if err := os.Mkdir(leaf, 0755); err != nil && !os.IsExist(err) {
+			return "", err
+		}
+		if err := writeCgroupFile(leaf, "cgroup.procs", strconv.Itoa(os.Getpid())); err != nil {
+			return "", err
+		}
+		if err := enable(); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// newCgroup creates the cgroup of the application name, limited to l.
+func newCgroup(name string, l limits) (*cgroup, error) {
+	base, err := delegatedCgroup()
+	if err != nil {
+		return nil, err
+	}
+
+	cg := &cgroup{dir: path.Join(base, "app-"+name)}
+	if err := os.Mkdir(cg.dir, 0755); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+
+	if l.memory > 0 {
+		if err := writeCgroupFile(cg.dir, "memory.max", strconv.FormatInt(l.memory, 10)); err != nil {
+			cg.remove()
+			return nil, err
+		}
+		// swapping would only delay the kill, freezing the machine meanwhile
+		writeCgroupFile(cg.dir, "memory.swap.max", "0")
+	}
+
+	if l.cpu > 0 {
+		period := 100000
+		quota := l.cpu * period / 100
+		if err := writeCgroupFile(cg.dir, "cpu.max", fmt.Sprintf("%d %d", quota, period)); err != nil {
+			cg.remove()
+			return nil, err
+		}
+	}
+	return cg, nil
+}
+
+// procs returns the file processes write their id to in order to join cg.
+func (cg *cgroup) procs() string {
+	return path.Join(cg.dir, "cgroup.procs")
+}
+
+// ooms returns how many processes of cg were killed for going over its
+// memory limit.
+func (cg *cgroup) ooms() int {
+	b, err := ioutil.ReadFile(path.Join(cg.dir, "memory.events"))
+	if err != nil {
+		return 0
+	}
+
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			n, _ := strconv.Atoi(fields[1])
+			return n
+		}
+	}
+	return 0
+}
+
+// remove kills the processes left in cg, and removes it.
+func (cg *cgroup) remove() error {
+	writeCgroupFile(cg.dir, "cgroup.kill", "1")
+	return os.Remove(cg.dir)
+}
+
+func writeCgroupFile(dir, name, value string) error {
+	return ioutil.WriteFile(path.Join(dir, name), []byte(value), 0644)
+}
@@ -4,31 +4,63 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"text/template"
+	"time"
 )
 
 type data map[string]interface{}
 
 type CommandCenter struct {
 	webApp
-	tld       string
-	autoStart bool
-	apps      map[string]*ShareableApp
-	templates map[string]*template.Template
+	tld         string
+	autoStart   []string
+	startGroups map[string][]string
+	tagPatterns map[string][]string
+	dirGroups   map[string]string
+	appDirs     map[string]string
+	restore     bool
+	appsMu      sync.RWMutex
+	apps        map[string]*ShareableApp
+	events      *EventBus
+	ports       *PortAllocator
+	inspector   *Inspector
+	metrics     *Metrics
+	usage       *usageSampler
+	state       *stateStore
+	csrfToken   string
+	templates   map[string]*template.Template
 }
 
 func NewCommandCenter(name string, c *Config) *CommandCenter {
-	cc := &CommandCenter{tld: c.Tld, autoStart: c.AutoStart}
+	cc := &CommandCenter{tld: c.Tld, startGroups: c.StartGroups, tagPatterns: c.Tags, restore: c.Restore}
 	cc.name = name
+	cc.csrfToken = newCSRFToken()
+	autoStart, err := parseAutoStart(c.AutoStart)
+	if err != nil {
+		log.Printf("WARN ignoring %v\n", err)
+	}
+	cc.autoStart = autoStart
+	cc.events = NewEventBus()
+	cc.ports = newPortAllocator(c)
+	cc.state = newStateStore(c.DataDir)
+	cc.inspector = NewInspector(c.Inspector)
+	cc.usage = newUsageSampler(cc.Apps)
+	cc.metrics = NewMetrics(cc.Apps, cc.usage)
 	cc.handler = cc.createHandler()
 	cc.apps = make(map[string]*ShareableApp)
+	cc.dirGroups = make(map[string]string)
+	cc.appDirs = make(map[string]string)
 	cc.parseTemplates()
 	cc.loadApps(c)
 	return cc
@@ -36,10 +68,26 @@ func NewCommandCenter(name string, c *Config) *CommandCenter {
 
 func (cc *CommandCenter) parseTemplates() {
 	tf := template.FuncMap{
-		"rootURL":   cc.rootURL,
-		"assetPath": cc.assetPath,
-		"appURL":    cc.appURL,
-		"actionURL": cc.actionURL,
+		"rootURL":    cc.rootURL,
+		"assetPath":  cc.assetPath,
+		"appURL":     cc.appURL,
+		"actionURL":  cc.actionURL,
+		"groupURL":   cc.groupURL,
+		"allURL":     cc.allURL,
+		"csrfToken":  func() string { return cc.csrfToken },
+		"filterURL":  cc.filterURL,
+		"tags":       cc.tags,
+		"requiredBy": cc.requiredBy,
+		"processes":  processes,
+		"processURL": cc.processURL,
+		"scaleURL":   cc.scaleURL,
+		"requestURL": cc.requestURL,
+		"inspecting": func() bool { return cc.inspector != nil },
+		"usage":      cc.usage.Usage,
+		"limits":     appLimits,
+		"limitKill":  limitKill,
+		"bytes":      formatBytes,
+		"uptime":     formatUptime,
 	}
 	cc.templates = make(map[string]*template.Template)
 	for name, html := range pagesHTML {
@@ -92,31 +140,107 @@ func (cc *CommandCenter) appURL(app string) string {
 	return fmt.Sprintf("http://%s.%s", app, cc.tld)
 }
 
+func (cc *CommandCenter) processURL(process, app string) string {
+	return fmt.Sprintf("http://%s.%s.%s", process, app, cc.tld)
+}
+
+// scaleURL returns the address of the action changing the number of
+// instances of process by delta.
+func (cc *CommandCenter) scaleURL(app, process string, count, delta int) string {
+	return fmt.Sprintf("%s?process=%s&count=%d", cc.actionURL("scale", app), process, count+delta)
+}
+
 func (cc *CommandCenter) actionURL(action, app string) string {
 	return fmt.Sprintf("%s/apps/%s/%s", cc.rootURL(), app, action)
 }
 
+func (cc *CommandCenter) allURL(action string) string {
+	return fmt.Sprintf("%s/all/%s", cc.rootURL(), action)
+}
+
+func (cc *CommandCenter) groupURL(action, group string) string {
+	return fmt.Sprintf("%s/groups/%s/%s", cc.rootURL(), group, action)
+}
+
+// filterURL returns the address of the index showing the applications
+// whose key, group or tag, has the given value.
+func (cc *CommandCenter) filterURL(key, value string) string {
+	return fmt.Sprintf("%s/?%s=%s", cc.rootURL(), key, url.QueryEscape(value))
+}
+
+// requestURL returns the address of a page of the requests inspector of
+// app, like a request or its replay.
+func (cc *CommandCenter) requestURL(app string, parts ...interface{}) string {
+	u := cc.actionURL("requests", app)
+	for _, p := range parts {
+		u = fmt.Sprintf("%s/%v", u, p)
+	}
+	return u
+}
+
 func (cc *CommandCenter) Get(name string) (App, bool) {
 	appName := strings.ToLower(name)
 	if cc.name == appName {
 		return cc, true
 	}
-	app, ok := cc.apps[appName]
+	return cc.app(appName)
+}
+
+func (cc *CommandCenter) app(name string) (*ShareableApp, bool) {
+	cc.appsMu.RLock()
+	defer cc.appsMu.RUnlock()
+	app, ok := cc.apps[strings.ToLower(name)]
 	return app, ok
 }
 
-func (cc *CommandCenter) Start() error {
-	if cc.autoStart {
-		go func() {
-			cc.startApps()
-		}()
+// Apps returns a snapshot of the registered applications sorted by name.
+func (cc *CommandCenter) Apps() []*ShareableApp {
+	cc.appsMu.RLock()
+	defer cc.appsMu.RUnlock()
+	apps := make([]*ShareableApp, 0, len(cc.apps))
+	for _, app := range cc.apps {
+		apps = append(apps, app)
 	}
+	sort.Sort(byName(apps))
+	return apps
+}
+
+type byName []*ShareableApp
+
+func (a byName) Len() int      { return len(a) }
+func (a byName) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byName) Less(i, j int) bool {
+	return strings.ToLower(a[i].Name()) < strings.ToLower(a[j].Name())
+}
+
+func (cc *CommandCenter) Start() error {
+	cc.trackState()
+	go cc.startOnLaunch()
 	return cc.webApp.Start()
 }
 
+// startOnLaunch restores the applications which were running when bam was
+// stopped, if enabled, and then starts the auto start applications which
+// weren't restored, so that the restored ones get their ports back.
+func (cc *CommandCenter) startOnLaunch() {
+	restored := make(map[*ShareableApp]bool)
+	if cc.restore {
+		restored = cc.restoreApps()
+	}
+
+	apps := []*ShareableApp{}
+	for _, app := range cc.autoStartApps() {
+		if !restored[app] {
+			apps = append(apps, app)
+		}
+	}
+	cc.startApps(apps)
+}
+
 func (cc *CommandCenter) Stop() error {
+	cc.state.Freeze(cc.Apps())
 	var wg sync.WaitGroup
-	for _, app := range cc.apps {
+	for _, app := range cc.Apps() {
 		if app.Running() {
 			wg.Add(1)
 			go func(a App) {
@@ -130,33 +254,359 @@ func (cc *CommandCenter) Stop() error {
 	return cc.webApp.Stop()
 }
 
-func (cc *CommandCenter) startApps() {
-	for _, app := range cc.apps {
-		go func(a App) {
-			log.Printf("starting %s\n", a.Name())
-			err := a.Start()
+// startApps starts apps at once, each one as soon as its dependencies
+// are ready, and waits for all of them.
+func (cc *CommandCenter) startApps(apps []*ShareableApp) error {
+	return forEach(apps, "start", func(a *ShareableApp) error {
+		log.Printf("starting %s\n", a.Name())
+		err := cc.start(a)
+		if err == errAlreadyStarted {
+			return nil
+		}
+		return err
+	})
+}
+
+// stopApps stops the running applications among apps at once, and waits
+// for all of them.
+func (cc *CommandCenter) stopApps(apps []*ShareableApp) error {
+	return forEach(running(apps), "stop", func(a *ShareableApp) error {
+		log.Printf("stopping %s\n", a.Name())
+		err := cc.stop(a)
+		if err == errNotStarted {
+			return nil
+		}
+		return err
+	})
+}
+
+// restartApps restarts the running applications among apps at once, and
+// waits for all of them.
+func (cc *CommandCenter) restartApps(apps []*ShareableApp) error {
+	return forEach(running(apps), "restart", func(a *ShareableApp) error {
+		log.Printf("restarting %s\n", a.Name())
+		return cc.restart(a)
+	})
+}
+
+// forEach calls f for each one of apps at once, and waits for all of them.
+// The failures are logged and returned together.
+func forEach(apps []*ShareableApp, verb string, f func(*ShareableApp) error) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failures := []string{}
+	for _, app := range apps {
+		wg.Add(1)
+		go func(a *ShareableApp) {
+			defer wg.Done()
+			err := f(a)
 			if err != nil {
-				log.Printf("Failed to start %s: %s\n", a.Name(), err)
+				log.Printf("Failed to %s %s: %s\n", verb, a.Name(), err)
+				mu.Lock()
+				failures = append(failures, fmt.Sprintf("%s: %v", a.Name(), err))
+				mu.Unlock()
 			}
 		}(app)
 	}
+	wg.Wait()
+
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		return fmt.Errorf("Failed to %s %s", verb, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// running returns the running applications among apps.
+func running(apps []*ShareableApp) []*ShareableApp {
+	r := []*ShareableApp{}
+	for _, app := range apps {
+		if app.Running() {
+			r = append(r, app)
+		}
+	}
+	return r
+}
+
+// trackState saves the state of the applications whenever one of them
+// starts, stops or is shared.
+func (cc *CommandCenter) trackState() {
+	if cc.state == nil {
+		return
+	}
+
+	events := cc.events.Subscribe()
+	go func() {
+		for e := range events {
+			switch e.Type {
+			case EventReady, EventStopped, EventCrashed, EventShared, EventUnshared:
+				cc.state.Save(cc.Apps())
+			}
+		}
+	}()
+}
+
+// restoreApps starts the applications which were running when bam was
+// stopped, on the same ports, sharing the ones which were shared, and
+// waits for them. It returns the applications it started.
+func (cc *CommandCenter) restoreApps() map[*ShareableApp]bool {
+	apps := []*ShareableApp{}
+	shared := make(map[*ShareableApp]bool)
+	for name, s := range cc.state.Load() {
+		app, found := cc.app(name)
+		if !found {
+			log.Printf("WARN Unable to restore %s: application not found\n", name)
+			continue
+		}
+
+		for process, port := range s.Ports {
+			cc.ports.Prefer(app.Name(), process, port)
+		}
+		apps = append(apps, app)
+		shared[app] = s.Shared
+	}
+
+	var mu sync.Mutex
+	restored := make(map[*ShareableApp]bool)
+	forEach(apps, "restore", func(a *ShareableApp) error {
+		log.Printf("restoring %s\n", a.Name())
+		err := cc.start(a)
+		if err != nil && err != errAlreadyStarted {
+			return err
+		}
+
+		mu.Lock()
+		restored[a] = true
+		mu.Unlock()
+
+		if shared[a] {
+			err = waitReady(a, readyTimeout)
+			if err == nil {
+				err = a.Share()
+			}
+			if err != nil {
+				log.Printf("Failed to share %s again: %s\n", a.Name(), err)
+			}
+		}
+		return nil
+	})
+	return restored
+}
+
+// start starts the dependencies of a and then a itself.
+func (cc *CommandCenter) start(a *ShareableApp) error {
+	err := cc.startDependencies(a)
+	if err != nil {
+		return err
+	}
+	return a.Start()
+}
+
+// startDependencies starts the dependencies of a in topological order,
+// waiting for each one to be ready.
+func (cc *CommandCenter) startDependencies(a *ShareableApp) error {
+	order, err := dependencyOrder(a.Name(), cc.getApp)
+	if err != nil {
+		return err
+	}
+
+	for _, dep := range order[:len(order)-1] {
+		if !dep.Running() {
+			log.Printf("starting %s, required by %s\n", dep.Name(), a.Name())
+			err := dep.Start()
+			if err != nil && err != errAlreadyStarted {
+				return fmt.Errorf("Unable to start %s, required by %s: %v", dep.Name(), a.Name(), err)
+			}
+		}
+
+		err := waitReady(dep, readyTimeout)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stop stops a, warning about the running applications which depend on it.
+func (cc *CommandCenter) stop(a *ShareableApp) error {
+	for _, d := range cc.dependents(a.Name()) {
+		if d.Running() {
+			log.Printf("WARN %s is required by %s, which is still running\n", a.Name(), d.Name())
+		}
+	}
+	return a.Stop()
+}
+
+// restart stops a and starts it again, along with its dependencies, on
+// the same ports and keeping it shared. A stopped application is just
+// started.
+func (cc *CommandCenter) restart(a *ShareableApp) error {
+	if !a.Running() && a.State() != Down {
+		return cc.start(a)
+	}
+
+	for process, port := range appPorts(a) {
+		cc.ports.Prefer(a.Name(), process, port)
+	}
+	return a.Restart(func() error { return cc.startDependencies(a) })
+}
+
+// dependents returns the applications depending directly on name.
+func (cc *CommandCenter) dependents(name string) []*ShareableApp {
+	apps := []*ShareableApp{}
+	for _, app := range cc.Apps() {
+		for _, dep := range dependencies(app) {
+			if strings.EqualFold(dep, name) {
+				apps = append(apps, app)
+				break
+			}
+		}
+	}
+	return apps
+}
+
+// requiredBy returns the names of the running applications depending on name.
+func (cc *CommandCenter) requiredBy(name string) string {
+	names := []string{}
+	for _, d := range cc.dependents(name) {
+		if d.Running() {
+			names = append(names, d.Name())
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// checkDependencies reports missing dependencies and dependency cycles.
+func (cc *CommandCenter) checkDependencies() {
+	for _, app := range cc.Apps() {
+		_, err := dependencyOrder(app.Name(), cc.getApp)
+		if err != nil {
+			log.Printf("WARN %s\n", err)
+		}
+	}
+}
+
+// siblings returns all registered applications.
+func (cc *CommandCenter) siblings() []App {
+	apps := []App{}
+	for _, app := range cc.Apps() {
+		apps = append(apps, app)
+	}
+	return apps
+}
+
+func (cc *CommandCenter) getApp(name string) (App, bool) {
+	return cc.app(name)
 }
 
 func (cc *CommandCenter) createHandler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", cc.index)
 	mux.HandleFunc("/apps/", cc.appsHandler)
+	mux.HandleFunc("/groups/", cc.groupsHandler)
+	mux.HandleFunc("/all/", cc.allHandler)
+	mux.HandleFunc("/events", cc.eventsHandler)
+	mux.HandleFunc("/usage", cc.usageHandler)
+	mux.Handle("/metrics", cc.metrics)
 	mux.Handle("/assets/", http.StripPrefix("/assets/", http.FileServer(FS(false))))
 	return mux
 }
 
 func (cc *CommandCenter) index(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := AppFilter{Group: q.Get("group"), Tag: q.Get("tag")}
 	cc.render(w, "index", data{
-		"Title": "BAM!",
-		"Apps":  cc.apps,
+		"Title":       "BAM!",
+		"Groups":      cc.groupedApps(f),
+		"Filter":      f,
+		"Tags":        cc.AllTags(),
+		"StartGroups": cc.StartGroups(),
 	})
 }
 
+// eventsHandler streams application events as Server-Sent Events.
+// The optional app parameter restricts the stream to a single application.
+func (cc *CommandCenter) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		cc.renderError(w, http.StatusInternalServerError, fmt.Errorf("Streaming unsupported"))
+		return
+	}
+
+	filter := strings.ToLower(r.URL.Query().Get("app"))
+	events := cc.events.Subscribe()
+	defer cc.events.Unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	f.Flush()
+
+	for {
+		select {
+		case e := <-events:
+			if filter != "" && strings.ToLower(e.App) != filter {
+				continue
+			}
+
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+			f.Flush()
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// usageHandler serves the resource usage of all running applications as JSON.
+func (cc *CommandCenter) usageHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, cc.usage.All())
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// groupsHandler lists the applications of each group as JSON, and starts
+// or stops the group, or start group, named by the request.
+func (cc *CommandCenter) groupsHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) == 3 && parts[2] == "" {
+		writeJSON(w, cc.Groups())
+		return
+	}
+
+	if len(parts) != 4 {
+		cc.renderError(w, http.StatusNotFound, fmt.Errorf("Page not found: %s", r.URL.Path))
+		return
+	}
+
+	name := parts[2]
+	switch parts[3] {
+	case "start":
+		cc.action(w, r, "group "+name, "starting", func() error { return cc.startGroup(name) })
+	case "stop":
+		cc.action(w, r, "group "+name, "stopping", func() error { return cc.stopGroup(name) })
+	default:
+		cc.renderError(w, http.StatusNotFound, fmt.Errorf("Page not found: %s", r.URL.Path))
+	}
+}
+
+// allHandler restarts all running applications, or stops all of them.
+func (cc *CommandCenter) allHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/all/restart":
+		cc.action(w, r, "all applications", "restarting", func() error { return cc.restartApps(cc.Apps()) })
+	case "/all/stop":
+		cc.action(w, r, "all applications", "stopping", func() error { return cc.stopApps(cc.Apps()) })
+	default:
+		cc.renderError(w, http.StatusNotFound, fmt.Errorf("Page not found: %s", r.URL.Path))
+	}
+}
+
 func (cc *CommandCenter) appsHandler(w http.ResponseWriter, r *http.Request) {
 	parts := strings.Split(r.URL.Path, "/")
 	name := parts[2]
@@ -165,7 +615,7 @@ func (cc *CommandCenter) appsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	app, found := cc.apps[strings.ToLower(name)]
+	app, found := cc.app(name)
 	if !found {
 		log.Printf("WARN Application not found: %s\n", name)
 		cc.renderError(w, http.StatusNotFound, fmt.Errorf("Application doesn't exist: %s", name))
@@ -179,10 +629,13 @@ func (cc *CommandCenter) appsHandler(w http.ResponseWriter, r *http.Request) {
 
 	switch action {
 	case "start":
-		cc.action(w, r, name, "starting", app.Start)
+		cc.action(w, r, name, "starting", func() error { return cc.start(app) })
 
 	case "stop":
-		cc.action(w, r, name, "stopping", app.Stop)
+		cc.action(w, r, name, "stopping", func() error { return cc.stop(app) })
+
+	case "restart":
+		cc.action(w, r, name, "restarting", func() error { return cc.restart(app) })
 
 	case "share":
 		cc.action(w, r, name, "sharing", app.Share)
@@ -190,6 +643,20 @@ func (cc *CommandCenter) appsHandler(w http.ResponseWriter, r *http.Request) {
 	case "unshare":
 		cc.action(w, r, name, "unsharing", app.Unshare)
 
+	case "scale":
+		cc.action(w, r, name, "scaling", func() error { return scale(app, r) })
+
+	case "requests":
+		cc.requests(w, r, app, parts[4:])
+
+	case "usage":
+		u := cc.usage.Usage(app.Name())
+		if u == nil {
+			cc.renderError(w, http.StatusNotFound, fmt.Errorf("No resource usage of %s", name))
+			return
+		}
+		writeJSON(w, u)
+
 	default:
 		cc.render(w, "app", data{
 			"Title": "BAM!",
@@ -198,8 +665,96 @@ func (cc *CommandCenter) appsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// requests serves the requests inspector of app: the requests, filtered
+// by method, path and status, their HAR archive, a single request or its
+// replay.
+func (cc *CommandCenter) requests(w http.ResponseWriter, r *http.Request, app *ShareableApp, parts []string) {
+	if cc.inspector == nil {
+		cc.renderError(w, http.StatusNotFound, fmt.Errorf("The requests inspector is disabled"))
+		return
+	}
+
+	q := r.URL.Query()
+	filter := RequestFilter{Method: q.Get("method"), Path: q.Get("path"), Status: q.Get("status")}
+	requests := filter.Filter(cc.inspector.Requests(app.Name()))
+
+	page := ""
+	if len(parts) > 0 {
+		page = parts[0]
+	}
+
+	switch page {
+	case "":
+		cc.render(w, "requests", data{
+			"Title":    "BAM!",
+			"App":      app,
+			"Filter":   filter,
+			"Requests": requests,
+			"Query":    r.URL.RawQuery,
+		})
+		return
+
+	case "har":
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", app.Name()+".har"))
+		writeJSON(w, newHAR(requests))
+		return
+	}
+
+	id, _ := strconv.Atoi(page)
+	rec, found := cc.inspector.Request(app.Name(), id)
+	if !found {
+		cc.renderError(w, http.StatusNotFound, fmt.Errorf("Request not found: %s", page))
+		return
+	}
+
+	if len(parts) > 1 && parts[1] == "replay" {
+		if !cc.checkCSRF(w, r) {
+			return
+		}
+
+		log.Printf("replaying request %d of %s\n", id, app.Name())
+		err := cc.inspector.Replay(rec)
+		if err != nil {
+			cc.renderError(w, http.StatusInternalServerError,
+				fmt.Errorf("An error occurred while replaying request %d of %s: %v", id, app.Name(), err))
+		} else {
+			http.Redirect(w, r, cc.requestURL(app.Name()), http.StatusFound)
+		}
+		return
+	}
+
+	cc.render(w, "request", data{
+		"Title":   "BAM!",
+		"App":     app,
+		"Request": rec,
+	})
+}
+
+// scaler is implemented by applications whose processes can be scaled.
+type scaler interface {
+	Scale(process string, count int) error
+}
+
+// scale sets the number of instances of the process given by the request.
+func scale(a App, r *http.Request) error {
+	s, ok := unwrap(a).(scaler)
+	if !ok {
+		return fmt.Errorf("%s can't be scaled", a.Name())
+	}
+
+	count, err := strconv.Atoi(r.FormValue("count"))
+	if err != nil {
+		return fmt.Errorf("Invalid number of instances: %s", r.FormValue("count"))
+	}
+	return s.Scale(r.FormValue("process"), count)
+}
+
 func (cc *CommandCenter) action(w http.ResponseWriter, r *http.Request,
 	name, desc string, action func() error) {
+	if !cc.checkCSRF(w, r) {
+		return
+	}
+
 	log.Printf("%s %s\n", desc, name)
 	err := action()
 	if err != nil {
@@ -213,25 +768,126 @@ func (cc *CommandCenter) action(w http.ResponseWriter, r *http.Request,
 
 func (cc *CommandCenter) register(a App) {
 	appName := strings.ToLower(a.Name())
+	cc.appsMu.Lock()
 	if _, ok := cc.apps[appName]; ok {
+		cc.appsMu.Unlock()
 		return
 	}
-	cc.apps[appName] = &ShareableApp{App: a}
+	cc.apps[appName] = &ShareableApp{App: a, events: cc.events}
+	cc.appsMu.Unlock()
+
+	if s, ok := a.(eventSource); ok {
+		s.setEventBus(cc.events)
+	}
+	if s, ok := a.(siblingAware); ok {
+		s.setSiblings(cc.siblings)
+	}
+	if s, ok := a.(portAware); ok {
+		s.setPortAllocator(cc.ports)
+	}
+	cc.events.Publish(Event{Type: EventRegistered, App: a.Name()})
 }
 
 func (cc *CommandCenter) loadApps(c *Config) {
 	cc.loadAliasApps(c.Aliases)
-	cc.loadProcessApps(c.AppsDir)
-	cc.loadWebServerApps(c.AppsDir)
+	cc.loadAppsDir(c.AppsDir, "")
+	for _, dir := range groupDirs(c.AppsDir) {
+		cc.loadAppsDir(dir, path.Base(dir))
+	}
+	cc.checkDependencies()
 }
 
-func (cc *CommandCenter) loadAliasApps(aliases map[string]int) {
-	for name, port := range aliases {
-		cc.register(NewAliasApp(name, port))
+// loadAppsDir loads the applications found in dir, grouping them in the
+// given group.
+func (cc *CommandCenter) loadAppsDir(dir, group string) {
+	cc.loadProcessApps(dir, group)
+	cc.loadComposeApps(dir, group)
+	cc.loadWebServerApps(dir, group)
+}
+
+// registerIn registers a, found at dir, as part of group, unless an
+// application with the same name was registered already. Applications
+// skipped for being named like one from another directory, or like an
+// alias, are reported.
+func (cc *CommandCenter) registerIn(group, dir string, a App) {
+	name := strings.ToLower(a.Name())
+	cc.appsMu.Lock()
+	other, found := cc.appDirs[name]
+	_, registered := cc.apps[name]
+	if !registered {
+		cc.appDirs[name] = dir
+		if group != "" {
+			cc.dirGroups[name] = group
+		}
+	}
+	cc.appsMu.Unlock()
+
+	if !registered {
+		cc.register(a)
+	} else if !found {
+		log.Printf("WARN ignoring application %s at %s: there's an alias with the same name\n", a.Name(), dir)
+	} else if other != dir {
+		log.Printf("WARN ignoring application %s at %s: there's an application with the same name at %s\n", a.Name(), dir, other)
+	}
+}
+
+func (cc *CommandCenter) loadAliasApps(aliases map[string]interface{}) {
+	for name, v := range aliases {
+		a, err := newAlias(name, v)
+		if err != nil {
+			log.Printf("WARN ignoring alias %s: %v\n", name, err)
+			continue
+		}
+		cc.register(a)
+		a.Start()
+	}
+}
+
+// newAlias creates the alias described by v: a local port, an upstream
+// URL or a table with port or url, skip_verify, health and interval keys.
+func newAlias(name string, v interface{}) (App, error) {
+	switch v := v.(type) {
+	case int64:
+		return NewAliasApp(name, int(v)), nil
+	case int:
+		return NewAliasApp(name, v), nil
+	case string:
+		return NewUpstreamApp(name, v, false)
+	case map[string]interface{}:
+		return newAliasFromTable(name, v)
+	}
+	return nil, fmt.Errorf("Invalid alias: %v", v)
+}
+
+func newAliasFromTable(name string, t map[string]interface{}) (App, error) {
+	var interval time.Duration
+	if s, ok := t["interval"].(string); ok {
+		var err error
+		interval, err = time.ParseDuration(s)
+		if err != nil {
+			return nil, err
+		}
 	}
+
+	var a App
+	if port, ok := t["port"].(int64); ok {
+		a = NewAliasApp(name, int(port))
+	} else {
+		rawurl, _ := t["url"].(string)
+		skipVerify, _ := t["skip_verify"].(bool)
+		var err error
+		a, err = NewUpstreamApp(name, rawurl, skipVerify)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	health, _ := t["health"].(string)
+	a.(healthChecked).setHealthCheck(health, interval)
+	return a, nil
 }
 
-func (cc *CommandCenter) loadProcessApps(dir string) {
+func (cc *CommandCenter) loadProcessApps(dir, group string) {
 	procfiles, err := filepath.Glob(fmt.Sprintf("%s/*/Procfile", dir))
 	if err != nil {
 		log.Printf("An error occurred while searching for Procfiles at directory %s: %s\n", dir, err)
@@ -243,35 +899,80 @@ func (cc *CommandCenter) loadProcessApps(dir string) {
 		if err != nil {
 			log.Printf("Unable to load application %s. Error: %s\n", p, err)
 		} else {
-			cc.register(app)
+			cc.registerIn(group, path.Dir(p), app)
 		}
 	}
 }
 
-func (cc *CommandCenter) loadWebServerApps(dir string) {
+func (cc *CommandCenter) loadComposeApps(dir, group string) {
+	for _, name := range composeFiles {
+		files, err := filepath.Glob(fmt.Sprintf("%s/*/%s", dir, name))
+		if err != nil {
+			log.Printf("An error occurred while searching for %s at directory %s: %s\n", name, dir, err)
+			return
+		}
+
+		for _, f := range files {
+			app, err := NewComposeApp(f, defaultDocker)
+			if err == errComposeNotConfigured {
+				continue
+			}
+
+			if err != nil {
+				log.Printf("Unable to load application %s. Error: %s\n", f, err)
+			} else {
+				cc.registerIn(group, path.Dir(f), app)
+			}
+		}
+	}
+}
+
+func (cc *CommandCenter) loadWebServerApps(dir, group string) {
 	pages, err := filepath.Glob(fmt.Sprintf("%s/*/index.html", dir))
 	if err != nil {
 		log.Printf("An error occurred while searching for index.html at directory %s: %s\n", dir, err)
 		return
 	}
 
+	dirs := []string{}
 	for _, p := range pages {
-		cc.register(NewWebServerApp(path.Dir(p)))
+		dirs = append(dirs, path.Dir(p))
+	}
+
+	// sites served from a subfolder, like dist/, have no index.html at the top
+	configs, _ := filepath.Glob(fmt.Sprintf("%s/*/%s", dir, appConfigFile))
+	for _, f := range configs {
+		c, err := parseAppConfig(path.Dir(f))
+		if err == nil && c.Static.Root != "" {
+			dirs = append(dirs, path.Dir(f))
+		}
+	}
+
+	for _, d := range dirs {
+		app, err := NewWebServerApp(d)
+		if err != nil {
+			log.Printf("Unable to load application %s. Error: %s\n", d, err)
+		} else {
+			cc.registerIn(group, d, app)
+		}
 	}
 }
 
 const baseHTML = `
+{{ define "csrf" }}<input type="hidden" name="csrf_token" value="{{ csrfToken }}">{{ end }}
 {{ define "root" }}
 <html>
   <head>
     <meta charset="utf-8">
     <title>{{.Title}}</title>
+    <meta name="csrf-token" content="{{ csrfToken }}">
 		<link rel="stylesheet" type="text/css" href="{{ assetPath "bam.css" }}">
   </head>
   <body>
     <div id="container">
 			{{ template "body" . }}
     </div>
+    <script type="text/javascript">var eventsURL = "{{ rootURL }}/events";</script>
     <script type="text/javascript" src="{{ assetPath "bam.js" }}"></script>
   </body>
 </html>
@@ -283,60 +984,106 @@ var pagesHTML = map[string]string{
 	{{ define "body" }}
 		<h1> <a href="{{ rootURL }}">BAM!</a> </h1>
 		<input type="text" id="search-box" placeholder="Search" onkeyup="search();"></input>
-		<ul class="list">
-			{{range .Apps}}
-				{{ if .Running}}
-					<li data-app="{{.Name}}" class="green">
-				{{ else }}
-					<li data-app="{{.Name}}" class="red">
+		<ul class="actions start-groups">
+			{{ range .StartGroups }}
+				<li><form class="action" method="post" action="{{ groupURL "start" . }}">{{ template "csrf" }}<button class="action-button" type="submit"> Start {{ . }} </button></form></li>
+			{{ end }}
+			<li><form class="action" method="post" action="{{ allURL "restart" }}">{{ template "csrf" }}<button class="action-button" type="submit"> Restart all running </button></form></li>
+			<li><form class="action" method="post" action="{{ allURL "stop" }}">{{ template "csrf" }}<button class="action-button" type="submit"> Stop all </button></form></li>
+		</ul>
+		{{ with .Tags }}
+			<ul class="tags">
+				{{ range . }}
+					<li><a class="tag{{ if eq . $.Filter.Tag }} selected{{ end }}" href="{{ filterURL "tag" . }}">{{ . | html }}</a></li>
 				{{ end }}
-					<a class="title" href="{{ appURL .Name }}">{{.Name}}</a>
-					<ul class="actions pull-right">
-						<li>
-							<a href="{{ actionURL "" .Name }}" title="Application info">
-								<img src="{{ assetPath "images/info.png" }}">
-							</a>
-						</li>
-						{{ if .Running}}
-							<li>
-								{{ if .Shared }}
-									<a href="{{ .URL }}">
-										<img src="{{ assetPath "images/shared.png" }}">
-									</a>
-								{{ else }}
-									<a href="{{ actionURL "share" .Name }}">
-										<img src="{{ assetPath "images/share.png" }}">
-									</a>
+			</ul>
+		{{ end }}
+		{{ if or .Filter.Tag .Filter.Group }}
+			<p class="filter">
+				Showing {{ with .Filter.Group }}group <b>{{ . | html }}</b>{{ end }}
+				{{ with .Filter.Tag }}tag <b>{{ . | html }}</b>{{ end }}
+				&middot; <a href="{{ rootURL }}">show all</a>
+			</p>
+		{{ end }}
+		<div data-live>
+			{{ range .Groups }}
+				<div class="group" data-group>
+					{{ if .Name }}
+						<h2>
+							<a href="{{ filterURL "group" .Name }}">{{ .Name | html }}</a>
+							<ul class="actions pull-right">
+								<li><form class="action" method="post" action="{{ groupURL "start" .Name }}">{{ template "csrf" }}<button class="action-button" type="submit"> Start all </button></form></li>
+								<li><form class="action" method="post" action="{{ groupURL "stop" .Name }}">{{ template "csrf" }}<button class="action-button" type="submit"> Stop all </button></form></li>
+							</ul>
+						</h2>
+					{{ end }}
+					<ul class="list">
+						{{ range .Apps }}
+							{{ if .Running}}
+								<li data-app="{{.Name}}" data-tags="{{ range tags . }}{{ . | html }} {{ end }}" class="green">
+							{{ else }}
+								<li data-app="{{.Name}}" data-tags="{{ range tags . }}{{ . | html }} {{ end }}" class="red">
+							{{ end }}
+								<a class="title" href="{{ appURL .Name }}">{{.Name}}</a>
+								{{ range tags . }}
+									<a class="tag" href="{{ filterURL "tag" . }}">{{ . | html }}</a>
 								{{ end }}
-							</li>
-							<li>
-								<a href="{{ actionURL "stop" .Name }}" title="Stop">
-									<img src="{{ assetPath "images/stop.png" }}">
-								</a>
-							</li>
-						{{ else }}
-							<li>
-								<a href="{{ actionURL "start" .Name }}" title="Start">
-									<img src="{{ assetPath "images/start.png" }}">
-								</a>
+								{{ with usage .Name }}
+									<span class="usage" data-usage>{{ printf "%.1f" .CPU }}% CPU &middot; {{ bytes .RSS }}</span>
+								{{ end }}
+								<ul class="actions pull-right">
+									<li>
+										<a href="{{ actionURL "" .Name }}" title="Application info">
+											<img src="{{ assetPath "images/info.png" }}">
+										</a>
+									</li>
+									{{ if .Running}}
+										<li>
+											{{ if .Shared }}
+												<a href="{{ .URL }}">
+													<img src="{{ assetPath "images/shared.png" }}">
+												</a>
+											{{ else }}
+												<form class="action" method="post" action="{{ actionURL "share" .Name }}">
+													{{ template "csrf" }}
+													<button type="submit" title="Share"><img src="{{ assetPath "images/share.png" }}"></button>
+												</form>
+											{{ end }}
+										</li>
+										<li>
+											<form class="action" method="post" action="{{ actionURL "stop" .Name }}">
+												{{ template "csrf" }}
+												<button type="submit" title="Stop"><img src="{{ assetPath "images/stop.png" }}"></button>
+											</form>
+										</li>
+									{{ else }}
+										<li>
+											<form class="action" method="post" action="{{ actionURL "start" .Name }}">
+												{{ template "csrf" }}
+												<button type="submit" title="Start"><img src="{{ assetPath "images/start.png" }}"></button>
+											</form>
+										</li>
+									{{ end }}
+								</ul>
 							</li>
 						{{ end }}
 					</ul>
-				</li>
-			{{end}}
-		</ul>
+				</div>
+			{{ end }}
+		</div>
 	{{ end }}`,
 	"error": `
 	{{ define "body" }}
 		<h1> <a href="{{ rootURL }}">BAM!</a> </h1>
 		<div class="error-box">
 			<h3>{{.Title}}</h3>
-			{{.Error}}
+			<pre>{{ .Error | html }}</pre>
 		</div>
 	{{ end }}`,
 	"app": `
 	{{ define "body" }}
 		<h1> <a href="{{ rootURL }}">BAM!</a> </h1>
+		<div data-live data-app="{{ .App.Name }}">
 		{{ if .App.Running }}
       <div class="status-running">
         <h2>{{ .App.Name }} is running!</h2>
@@ -345,19 +1092,125 @@ var pagesHTML = map[string]string{
         <li><a class="action-button" href="{{ appURL .App.Name }}"> Go to appplication </a></li>
 				{{ if .App.Shared }}
 					<li><a class="action-button" href="{{ .App.URL }}"> Copy public address </a></li>
-					<li><a class="action-button" href="{{ actionURL "unshare" .App.Name }}"> Unshare </a></li>
+					<li><form class="action" method="post" action="{{ actionURL "unshare" .App.Name }}">{{ template "csrf" }}<button class="action-button" type="submit"> Unshare </button></form></li>
 				{{ else }}
-					<li><a class="action-button" href="{{ actionURL "share" .App.Name }}"> Share </a></li>
+					<li><form class="action" method="post" action="{{ actionURL "share" .App.Name }}">{{ template "csrf" }}<button class="action-button" type="submit"> Share </button></form></li>
 				{{ end }}
-        <li><a class="action-button" href="{{ actionURL "stop" .App.Name }}"> Stop </a></li>
+        <li><form class="action" method="post" action="{{ actionURL "restart" .App.Name }}">{{ template "csrf" }}<button class="action-button" type="submit"> Restart </button></form></li>
+        <li><form class="action" method="post" action="{{ actionURL "stop" .App.Name }}">{{ template "csrf" }}<button class="action-button" type="submit"> Stop </button></form></li>
       </ul>
+			{{ with requiredBy .App.Name }}
+				<p class="warning">Required by {{ . }}.</p>
+			{{ end }}
 		{{ else }}
       <div class="status-stopped">
-        <h2>{{ .App.Name }} is stopped!</h2>
+        <h2>{{ .App.Name }} is {{ .App.State }}!</h2>
       </div>
       <ul class="actions">
-        <li><a class="action-button" href="{{ actionURL "start" .App.Name }}"> Start </a></li>
+        <li><form class="action" method="post" action="{{ actionURL "start" .App.Name }}">{{ template "csrf" }}<button class="action-button" type="submit"> Start </button></form></li>
+				{{ if eq .App.State.String "down" }}
+					<li><form class="action" method="post" action="{{ actionURL "restart" .App.Name }}">{{ template "csrf" }}<button class="action-button" type="submit"> Restart </button></form></li>
+					<li><form class="action" method="post" action="{{ actionURL "stop" .App.Name }}">{{ template "csrf" }}<button class="action-button" type="submit"> Stop </button></form></li>
+				{{ end }}
       </ul>
+			{{ with limitKill .App }}
+				<p class="warning">{{ . | html }}</p>
+			{{ end }}
+			{{ if eq .App.State.String "down" }}
+				<p class="warning">Not answering its health checks. Requests will be proxied again as soon as it's back up.</p>
+			{{ end }}
+		{{ end }}
+		{{ with usage .App.Name }}
+			<table class="usage" data-usage>
+				<tr><th>CPU</th><td>{{ printf "%.1f" .CPU }}%</td></tr>
+				<tr><th>Memory</th><td>{{ bytes .RSS }}</td></tr>
+				<tr><th>Open files</th><td>{{ .OpenFiles }}</td></tr>
+				<tr><th>Processes</th><td>{{ .Processes }}</td></tr>
+				<tr><th>Uptime</th><td>{{ uptime .Uptime }}</td></tr>
+			</table>
+		{{ end }}
+		{{ with limits .App }}
+			<p>Limited to {{ . }}.</p>
+		{{ end }}
+		{{ if inspecting }}
+			<p><a href="{{ requestURL .App.Name }}">Inspect requests</a></p>
+		{{ end }}
+		{{ with processes .App }}
+			<ul class="processes">
+				{{ range . }}
+					<li>
+						<a href="{{ processURL .Name $.App.Name }}">{{ .Name }}</a> &times; {{ .Count }}
+						<form class="action" method="post" action="{{ scaleURL $.App.Name .Name .Count -1 }}">{{ template "csrf" }}<button type="submit" title="Scale down">&minus;</button></form>
+						<form class="action" method="post" action="{{ scaleURL $.App.Name .Name .Count 1 }}">{{ template "csrf" }}<button type="submit" title="Scale up">+</button></form>
+						<ul>
+							{{ range .Instances }}
+								<li>{{ .Name }} on {{ if .Socket }}socket {{ .Socket }}{{ else }}port {{ .Port }}{{ end }}</li>
+							{{ end }}
+						</ul>
+					</li>
+				{{ end }}
+			</ul>
+		{{ end }}
+		</div>
+	{{ end }}`,
+	"requests": `
+	{{ define "body" }}
+		<h1> <a href="{{ rootURL }}">BAM!</a> </h1>
+		<h2><a href="{{ actionURL "" .App.Name }}">{{ .App.Name }}</a> requests</h2>
+		<form class="request-filter" method="get" action="{{ requestURL .App.Name }}">
+			<input type="text" name="method" placeholder="Method" value="{{ .Filter.Method | html }}">
+			<input type="text" name="path" placeholder="Path" value="{{ .Filter.Path | html }}">
+			<input type="text" name="status" placeholder="Status, like 404 or 5xx" value="{{ .Filter.Status | html }}">
+			<input type="submit" value="Filter">
+		</form>
+		<p><a href="{{ requestURL .App.Name "har" }}{{ with .Query }}?{{ . | html }}{{ end }}">Export as HAR</a></p>
+		<table class="requests">
+			{{ range .Requests }}
+				<tr>
+					<td>{{ .Time.Format "15:04:05" }}</td>
+					<td>{{ .Method | html }}</td>
+					<td><a href="{{ requestURL $.App.Name .ID }}">{{ .URL | html }}</a></td>
+					<td>{{ .Status }}</td>
+					<td>{{ .Duration }}</td>
+				</tr>
+			{{ else }}
+				<tr><td>No requests yet.</td></tr>
+			{{ end }}
+		</table>
+	{{ end }}`,
+	"request": `
+	{{ define "body" }}
+		<h1> <a href="{{ rootURL }}">BAM!</a> </h1>
+		{{ with .Request }}
+			<h2>{{ .Method | html }} {{ .URL | html }}</h2>
+			<p>{{ .Status }} in {{ .Duration }}, at {{ .Time.Format "2006-01-02 15:04:05" }}</p>
+			<ul class="actions">
+				<li><form class="action" method="post" action="{{ requestURL $.App.Name .ID "replay" }}">{{ template "csrf" }}<button class="action-button" type="submit"> Replay this request </button></form></li>
+				<li><a class="action-button" href="{{ requestURL $.App.Name }}"> All requests </a></li>
+			</ul>
+			<h3>Request</h3>
+			<pre class="headers">{{ .Method | html }} {{ .URL | html }} {{ .Proto | html }}
+Host: {{ .Host | html }}
+{{ range $name, $values := .RequestHeader }}{{ range $values }}{{ $name | html }}: {{ . | html }}
+{{ end }}{{ end }}</pre>
+			{{ template "body-content" .RequestBody }}
+			<h3>Response</h3>
+			<pre class="headers">{{ .Status }}
+{{ range $name, $values := .ResponseHeader }}{{ range $values }}{{ $name | html }}: {{ . | html }}
+{{ end }}{{ end }}</pre>
+			{{ template "body-content" .ResponseBody }}
+		{{ end }}
+	{{ end }}
+	{{ define "body-content" }}
+		{{ if .Size }}
+			{{ if .IsText }}
+				<pre class="body">{{ .Text | html }}</pre>
+			{{ else }}
+				<p>{{ .Size }} bytes of binary data.</p>
+			{{ end }}
+			{{ if .Truncated }}
+				<p class="warning">Only the first {{ len .Data }} of {{ .Size }} bytes were kept.</p>
+			{{ end }}
 		{{ end }}
 	{{ end }}`,
 }
@@ -187,33 +187,54 @@ var _escData = map[string]*_escFile{
 
 	"/bam.css": {
 		local: "public/bam.css",
-		size:  2187,
+		size:  3664,
 		compressed: `
-H4sIAAAJbogA/5RV207rOBR971dYVPMyaqKkpC1NpZGYXjRP8w+uvZNauHZkO0AP4t+PHcdJmhZ0gBey
-ve9rrc3f6GOC0FG+R5r9YqLM7d+KgoqsaTP5nBwlvXgXTF5KJWtBIyK5VDmaAimSIt3Yx0IKExX4zPgl
-Rw//AX8FwwhG/0MND7Pue/asGOYzjYWONChWdLG2OOQozaqm6CltSjYvb8DKk8nRKklG3vN4AWfnPiXW
-iJkA1YS9MWpOOVonf7mAM36PWstqkbj8CFWYUjtrpHzqdHFt5lAMrGesSiaCL66NHFi9qzd+TmreNMCZ
-tj2aC7dNCilgkDtHSR+dI1vCGT4nnKEPFPaKMd4gly12mdA/yL0Oc6TJsLUmzaZB0SFnn21WLTmjaEoI
-6V8ihSmrdY7aNQ8LxKUCELaJ1tUPtugzpfhI1mTcV3wBzuXbN3FFSrKkuIlTQL8JglVGHm+LlQpfvok6
-Uhu0aqMwMUwK3W+PMl1xbPnJBGcjUBbdQkIYO5dDMqVLv+JXUI7IPMKclXbzZ0YpBxeLZwjnr0wz4yaz
-rgHNJFllu7ULNvBuIgpEKuyK9OToteVtSEEF2CBNlOQcJfbXKCuaCisQpqkWG2Y49DJpJeEEMRLOwgvH
-zRydWlsap0PCH6Ux8tytoWNDV6UbpmdBj/2tV495i/StS49wwPXWp8czrmrOvQTte8EltkM0n+51EoNS
-sjlZI50EYdzersN8t9/tB9oID/t/t9tds51geV5nWTa/L7ArWL7S2aC902PTYRBuMmahvwZTDViRUzdQ
-IGHiT1pAMVte3S1/FzqqDu/qkzeNOPDofr5q++452W63o/7yQpJat/9Erha5XD4f9utm/hOjcK1Bz3z7
-pA02tY5ULYQdYYaCQRtZVa2SbvBsj2+g7Tz5quE/gKeVZatnYj1B3ensStKtCu4za3c4JLunO8wKUX3u
-4ZAjYfyQtSHK5vYXLDrWdjniHn06EI5ckpcfEejqsGT+sNxb3w8o1Yrcdv47AAD//73tIoCLCAAA
+H4sIAAAAAAAC/51X227jNhB991cQCfpSWILk2HEiYxdIYwd96g8s+kBLI4kILaokFcdd+N9LUqRupo1s
+YwRJhjOc25kzzO/o5wyhPfsMBPmXVEWifucZ8ECJNrPzbM+yU6uC0/eCs6bKgpRRxhN0D2ke5fFGHeas
+kkGOD4SeEnT3J9APkCTF6C9o4G7e/T1/4QTTucCVCARwkne2yjkkKF7WxmkZG5fm5AikKGWC1lE00V6E
+Kzho9ftUCTGpgBuzI8lkmaDn6DdtcMCfgZWsV5G+H6EaZ5nKNeDt1fFqLKaQD6QHzAtSOV3cSDaQtqqt
+8DxrqAmAEqFilCeqgqxYBYO7ExT11glSLrTgPKME/USurhjjDdK3hfom9B3p0+EdcTQMzVyzMV3UnVPH
+6lbBKMnQfZqm/UnAcUYakSBb5qGDsOAAlQrCqraJrfqbYrxPn9NpXOEJKGXHG3Z5nC6j/MKOQ3bDCNbL
+9OHSWcHx6YbVPlNGa2uFU0lYJfrqZUTUFCt8koqSSVNWXUGcGTkUQzDFj22JP4BrINMAU1Koyh9IllHQ
+tniOcPJBBJE6M6XquhlF6+X2WRtL+JRBBinjWDvpwdHPVitDHGrAEomUM0pRpD6Sq6GpMYdKGm+hJJJC
+PyZ2JPRATAZn1Q6OzjkorSwO4yHg90xKdujK0KGh89Il06Og7/2lVt9z2+lLlb7Drq+XOn0/w7qhtB1B
+dZ5ThlUS5k99OguBc2YoazInbjAuuettsd1td4PZcAe7P15ft6Y6TvLyvFwuF/4BG7XlxpzVnKUgBAjP
+NHckMNKzXDLimdg2KDxiXinbEc6e8GP2sNfHKqAqbAQuYKSwXq8nDBqFTy1gxl6iLmyJC/ElSuu1r8+b
+QS0ufIfBnrL0fUhpkS6e+Y5GvhZK8tR21ZeIy3W1Wl1pPAB4OuVyNhGGAiik0znO8/zKlW7Cz7M6zAmV
+dg+N6n6eZeQj1Ia1KlG5GDRXJWUggKYLLg4f2gUn8Z6C7agsjanhEktCum1X19p5OB01byFxLBVNBQon
+qXKjhMGR43pYfl2PNqKRffkwijvaeHF8LwDztOzm0XFo1G5kR0LLx9HatU4d0w7rYBs+obAH/XVt6rzb
+8PX1dRJfkrO0EfYNNOKBx8eXt51paliSDMaobUdAHQmJZSMC3lR6HufICYRkdW0BdEFHdtoc6y6iawF/
+gV3GSEiVJnBPZCNAWhL3g3n79hZtnzzE6Kz6u4dJTnj9F0nXWam72wUc7BtVnMoHn64JHWd8GUCjvbhs
+96KvfL8AKbuj9EvZROyJ//IhMN33hrkaLrRazYgLYvSqJlWpXsxm+eeMH6yfay+bwYSO9QdxjZ+kLrdr
+b5KNN5NBkbsAPbn4YvBUyt/IG1X3dFlBiMM/Dah9ZbmYVHUjf8hTDd/udLfv/r7Yv/+HRVpStr6ED6k9
+yCmuhYrQ/eYxl9mtoBxVDKLY7XZm43AIS8BKScw1k4fdP2xXOf6o7gz2HPC7miH9Q8GfXpvYlf5sfP98
++N86/wFsRnIOUA4AAA==
 `,
 	},
 
 	"/bam.js": {
 		local: "public/bam.js",
-		size:  342,
+		size:  2859,
 		compressed: `
-H4sIAAAJbogA/0yQQW8CIRCF7/wKbrCxEu+0h5r00KS3Hjd7QBh3SRAsDEbT+N87iJqeIG/me+/ByWRe
-wGS7bNOZv3GXbD1ARDUDfgRo1+3l00nRl9a7dBaDZg0zx2P5T/xUyJdvCGAx5fcQpAh+dAbNmjanRrF9
-jRZ9ivdIOfBfxnkzi8nBC4/mAJqUfcpcNtlTwEbT8XqLUwHijAsJq1Vn+Y2krTYe/aS7Rj6ktZEyiNnv
-KkIZxaONmNTJhAr66aBsMKV8+YIK0zwHkGLxDkTvpO59nz/V8YFqbYZmcmVXxh6P0uwvAAD//0JT8xxW
-AQAA
+H4sIAAAAAAAC/5VWTW/bOBC9+1dweyhlJFF92F7qdYt+pJsALnaRpEABwwdGGttMaVJLUkmMbf/7zvBD
+UhrH28KAJQ9nhsM3bx59KyxzIGy1eWfu2YzVpmq3oH25Bn+qgF7f7c7rgkenk2tzz8fT0S2GiaZxw4h/
+WrC7S1BQeWPfKlVwJRe18OIEPZcUNVq1uvLS6LRlMWb/jhiTK1b81hURbYxZ8K3VU3z/PsIv2lGbGo6Z
+h3tP5pWxrCCzxComU3z8EWoqFei136Dh6Cgno0j0ouWFXE6DjfKgjZZK4b2V160Ht+C5ZL4sb4VqIXpT
+kftdvVg7vsw7pbxHM8bxc8QOxQzzf+/qLCslnJtL50tv1msFBd/IGng8eZmg6/CKScZ4+Mm4Q+vFC7a2
+psUG3W2MAzq4kpUg7B0TFg1KMcxagw4/06s3JkGdog+2NzY3eIb2DlpyE1tyg1XFTF1TbvqmkKPbmDuN
+ztFrcbP8Hxq90sYXJeExjluyQeiTwIVdUglsNpt1UCFYCJWFlQW3wWejRAWOwS3WwJS8BWRqZKxZMb8B
+1og1sDuJaaR3rGqtRWwYujt0KnuCp5SJ4XTS+40ltsEd+/JpfuZ9cwF4VOeLUAqulqYBXfA/T6+wYmVi
+t8oNZuo8MGWDHYSrXUN05rk5vEuhlRE1LuVCiiHY8ZSzB6me7CudfpkxpugAx08Q4kHgviElh9yM58+D
+KVS2b3BZ8MaZLaXWYM+uPs3pdOT+wDgcol8XJorKkhSIkfF0oGsyRZ68rfoBctR3qQMprkX1lVio62Mc
+LKPXkSG09P7y4iOO1VfQuKRrslGmQCPpMk2gZkZXQKs7jslro6Fkp9Ya6zIrO/oNWOba6630sawCSat9
+zzdEfosoBGvphUVBn2axpbV+Wti3b+wHU1kZ7YXUruAiZOfjfbrMUvrGhucHWIlWBUanIsLJn+xFwbfg
+xUKLLcyeVc6uToL/s9STX5mav/+6pLEJp4gVj/NpQ85cfWyqT1nOQNSAZXw5oT6dXJEn6Sw9AwSEaD7q
+4fminUJyL3zr2OsZ+30y6VncARDKTZQbmO+s9FA8mHEU+8d+lUI57+P7ZmTyd8LzmMeE4kcE6ANSvyCk
+xpHZHZ0Udh704Fb2qDMofKfU3EvTWmQhqSdHpsNKaqg5cSd5BQq4zxfzH30O3OgHNWWPoAT20u8DOXGo
+MWUQmf3XeuZWa1UekFD2ESso9g3jb/A5o9sbdIU38ueL8/dmi11BT3LJV+4rxnumuoRPIOsAsQK36ZwI
+KtKmBU75mtC2iM8x48ga66Ve07tFUu6i0TRNXK+sIJWg1xqvsrC6ESm41el9+dTforDtPnmNRZeirkPF
+80AAnIgQgAJ7nPnU35e9Tma6TEdd/x4l4lGi6A4eaBUJBKrgBSTQWpf00Ilto1AN9wirM0H9XLjMESq8
+gEmIB/c3xjVgpanxn45Su3JEbDlMrbDxMosbCsM5zrzF9hYp5zF7OZlMwpz8BzrsWNorCwAA
 `,
 	},
 
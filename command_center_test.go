@@ -44,7 +44,7 @@ func TestCommandCenter(t *testing.T) {
 	}
 
 	static := cc.apps["static"]
-	res = request(t, "GET", "http://localhost:%d/apps/%s/start", cc.Port(), static.Name())
+	res = requestAction(t, cc, "start", static.Name())
 	verifyResponse(t, res, http.StatusOK)
 
 	<-time.After(1 * time.Second) // wait for static server to start
@@ -56,7 +56,7 @@ func TestCommandCenter(t *testing.T) {
 	res = request(t, "GET", "http://localhost:%d", static.Port())
 	verifyResponse(t, res, http.StatusOK, "It works!")
 
-	res = request(t, "GET", "http://localhost:%d/apps/%s/stop", cc.Port(), static.Name())
+	res = requestAction(t, cc, "stop", static.Name())
 	verifyResponse(t, res, http.StatusOK)
 
 	<-time.After(1 * time.Second) // wait for static server to stop
@@ -80,6 +80,23 @@ func request(t *testing.T, method string, url string, args ...interface{}) *http
 	return res
 }
 
+// requestAction posts the action on app to the running cc, along with its
+// CSRF token.
+func requestAction(t *testing.T, cc *CommandCenter, action, app string) *http.Response {
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/apps/%s/%s", cc.Port(), app, action), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Close = true
+	req.Header.Set(csrfHeader, cc.csrfToken)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
 func verifyResponse(t *testing.T, r *http.Response, status int, contentParts ...string) {
 	if r.StatusCode != status {
 		t.Errorf("Status code: got %d; expected %d", r.StatusCode, status)
@@ -97,3 +114,70 @@ func verifyResponse(t *testing.T, r *http.Response, status int, contentParts ...
 		}
 	}
 }
+
+func TestRestart(t *testing.T) {
+	c := &Config{AppsDir: "./examples/", Tld: "app"}
+	cc := NewCommandCenter("bam", c)
+
+	static, _ := cc.app("static")
+	ping, _ := cc.app("ping")
+	if w := postAction(cc, "/apps/static/restart"); w.Code != http.StatusFound || !static.Running() {
+		t.Fatalf("Restarting a stopped application should start it: got %d", w.Code)
+	}
+	defer static.Stop()
+
+	port := static.Port()
+	if w := postAction(cc, "/apps/static/restart"); w.Code != http.StatusFound {
+		t.Fatalf("Status code: got %d; expected %d", w.Code, http.StatusFound)
+	}
+
+	if !static.Running() || static.Port() != port {
+		t.Errorf("Restarted static: running %v on port %d; expected port %d", static.Running(), static.Port(), port)
+	}
+
+	if w := postAction(cc, "/all/restart"); w.Code != http.StatusFound {
+		t.Fatalf("Status code: got %d; expected %d", w.Code, http.StatusFound)
+	}
+
+	if !static.Running() || ping.Running() {
+		t.Errorf("Only the running applications should be restarted")
+	}
+
+	if w := postAction(cc, "/all/stop"); w.Code != http.StatusFound {
+		t.Fatalf("Status code: got %d; expected %d", w.Code, http.StatusFound)
+	}
+
+	for _, app := range cc.Apps() {
+		if app.Running() {
+			t.Errorf("Application should be stopped: %s", app.Name())
+		}
+	}
+}
+
+func TestRestartConcurrentStart(t *testing.T) {
+	cc := NewCommandCenter("bam", &Config{AppsDir: "./examples/", Tld: "app"})
+	static, _ := cc.app("static")
+	if err := cc.start(static); err != nil {
+		t.Fatal(err)
+	}
+	defer static.Stop()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				static.Start()
+			}
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		if err := cc.restart(static); err != nil {
+			t.Fatalf("Restart interleaved with a start: %v", err)
+		}
+	}
+}
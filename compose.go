@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// composeFiles are the names of the Docker Compose files bam looks for.
+var composeFiles = []string{"docker-compose.yml", "docker-compose.yaml", "compose.yaml", "compose.yml"}
+
+var errComposeNotConfigured = errors.New("Compose service not configured")
+
+// composeInterval is how often the containers of running compose
+// applications are checked.
+var composeInterval = 2 * time.Second
+
+// Docker runs the docker command line tool.
+type Docker interface {
+	// Command returns the command running docker with args in dir.
+	Command(dir string, args ...string) *exec.Cmd
+}
+
+type dockerCLI struct {
+	path string
+}
+
+func (d *dockerCLI) Command(dir string, args ...string) *exec.Cmd {
+	cmd := exec.Command(d.path, args...)
+	cmd.Dir = dir
+	return cmd
+}
+
+// defaultDocker runs the docker binary found in PATH.
+var defaultDocker Docker = &dockerCLI{path: "docker"}
+
+// composeApp is an application run by Docker Compose. Requests are proxied
+// to the host port published for the configured service's container port.
+// While started, the service's containers are checked every interval and
+// the application crashes once none of them is running.
+type composeApp struct {
+	app
+	dir      string
+	file     string
+	service  string
+	target   int
+	docker   Docker
+	interval time.Duration
+	done     chan struct{}
+	logs     *exec.Cmd
+	logsDone chan struct{}
+	logsMu   sync.Mutex
+}
+
+func (a *composeApp) Start() error {
+	a.ops.Lock()
+	defer a.ops.Unlock()
+
+	if a.Running() {
+		return errAlreadyStarted
+	}
+
+	a.setState(Starting)
+	_, err := a.compose("up", "-d")
+	if err != nil {
+		a.setState(Stopped)
+		return err
+	}
+
+	out, err := a.compose("port", a.service, fmt.Sprint(a.target))
+	if err != nil {
+		a.compose("down")
+		a.setState(Stopped)
+		return err
+	}
+
+	port, err := AddrPort(strings.TrimSpace(strings.SplitN(out, "\n", 2)[0]))
+	if err != nil {
+		a.compose("down")
+		a.setState(Stopped)
+		return fmt.Errorf("Unable to find the port published for %s:%d: %v", a.service, a.target, err)
+	}
+
+	done := make(chan struct{})
+	a.mu.Lock()
+	a.port = port
+	a.state = Running
+	a.done = done
+	a.mu.Unlock()
+	a.notify(Running)
+
+	a.followLogs()
+	go a.monitor(done)
+	return nil
+}
+
+func (a *composeApp) Stop() error {
+	a.ops.Lock()
+	defer a.ops.Unlock()
+
+	if !a.Running() {
+		return errNotStarted
+	}
+
+	a.mu.Lock()
+	done := a.done
+	a.done = nil
+	a.state = Stopping
+	a.mu.Unlock()
+
+	close(done)
+	a.stopLogs()
+	_, err := a.compose("down")
+	a.setState(Stopped)
+	return err
+}
+
+func (a *composeApp) Running() bool {
+	return a.State() == Running
+}
+
+// monitor checks the containers of the service until done is closed,
+// marking the application as crashed once none of them is running and
+// taking down the remaining containers.
+func (a *composeApp) monitor(done chan struct{}) {
+	t := time.NewTicker(a.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+
+		running, err := a.containersRunning()
+		if err != nil || running {
+			continue
+		}
+
+		a.ops.Lock()
+		a.mu.Lock()
+		crashed := a.done == done && a.state == Running
+		if crashed {
+			a.done = nil
+			a.state = Crashed
+		}
+		a.mu.Unlock()
+
+		if crashed {
+			a.stopLogs()
+			if _, err := a.compose("down"); err != nil {
+				log.Printf("WARN %s: %v\n", a.Name(), err)
+			}
+		}
+		a.ops.Unlock()
+
+		if crashed {
+			a.publish(EventCrashed, fmt.Sprintf("%s containers are not running", a.service))
+		}
+		return
+	}
+}
+
+// containersRunning tells whether any container of the service is running.
+func (a *composeApp) containersRunning() (bool, error) {
+	out, err := a.compose("ps", "-q", "--status", "running", a.service)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out) != "", nil
+}
+
+// followLogs copies the output of the containers to bam's output and
+// publishes it as log events until the application is stopped.
+func (a *composeApp) followLogs() {
+	prefix := fmt.Sprintf("[%s:compose] ", a.Name())
+	cmd := a.command("logs", "-f", "--no-color")
+	cmd.Stdout = a.output(os.Stdout, prefix, "compose")
+	cmd.Stderr = a.output(os.Stderr, prefix, "compose")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	err := cmd.Start()
+	if err != nil {
+		a.publish(EventLog, fmt.Sprintf("compose: unable to follow logs: %v", err))
+		return
+	}
+
+	done := make(chan struct{})
+	a.logsMu.Lock()
+	a.logs = cmd
+	a.logsDone = done
+	a.logsMu.Unlock()
+
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+}
+
+// stopLogs kills the command following the logs, along with the processes
+// it started, such as the docker compose plugin, and waits for it to exit.
+func (a *composeApp) stopLogs() {
+	a.logsMu.Lock()
+	cmd, done := a.logs, a.logsDone
+	a.logs = nil
+	a.logsDone = nil
+	a.logsMu.Unlock()
+
+	if cmd != nil {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+	}
+}
+
+func (a *composeApp) command(args ...string) *exec.Cmd {
+	return a.docker.Command(a.dir, append([]string{"compose", "-f", a.file}, args...)...)
+}
+
+// compose runs a docker compose subcommand, returning its standard output.
+// The standard error, where warnings are written even on success, is only
+// used to report failures.
+func (a *composeApp) compose(args ...string) (string, error) {
+	cmd := a.command(args...)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("docker compose %s failed: %v\n%s", strings.Join(args, " "), err, stderr)
+	}
+	return string(out), nil
+}
+
+// NewComposeApp creates an application from a Docker Compose file. The
+// service and its container port are read from the application's settings.
+func NewComposeApp(composeFile string, docker Docker) (App, error) {
+	dir := path.Dir(composeFile)
+	c, err := parseAppConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Compose.Service == "" || c.Compose.Port <= 0 {
+		return nil, errComposeNotConfigured
+	}
+
+	a := &composeApp{
+		dir:      dir,
+		file:     path.Base(composeFile),
+		service:  c.Compose.Service,
+		target:   c.Compose.Port,
+		docker:   docker,
+		interval: composeInterval,
+	}
+	a.name = path.Base(dir)
+	a.dependsOn = c.DependsOn
+	a.autoStart = c.AutoStart
+	a.group = c.Group
+	a.tags = c.Tags
+	return a, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+const fakeDocker = `#!/bin/sh
+echo "$@" >> docker.log
+echo 'WARN[0000] docker-compose.yml: the attribute "version" is obsolete' >&2
+case "$*" in
+  *" up -d") echo "c0ffee" > running ;;
+  *" down") rm -f running ;;
+  *" ps "*) cat running 2>/dev/null || true ;;
+  *" port web 80") echo "0.0.0.0:4242" ;;
+  *" logs "*) echo "container ready"; sleep 10 ;;
+esac
+`
+
+// newTestComposeApp creates a compose application in a temporary directory
+// run by fakeDocker.
+func newTestComposeApp(t *testing.T) (App, string) {
+	dir, err := ioutil.TempDir("", "bam")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"docker-compose.yml": "services: {}\n",
+		".bam.toml":          "[compose]\nservice = \"web\"\nport = 80\n",
+		"docker":             fakeDocker,
+	}
+	for name, content := range files {
+		ioutil.WriteFile(path.Join(dir, name), []byte(content), 0755)
+	}
+
+	a, err := NewComposeApp(path.Join(dir, "docker-compose.yml"), &dockerCLI{path: path.Join(dir, "docker")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, dir
+}
+
+func TestComposeApp(t *testing.T) {
+	a, dir := newTestComposeApp(t)
+	defer os.RemoveAll(dir)
+
+	bus := NewEventBus()
+	events := bus.Subscribe()
+	defer bus.Unsubscribe(events)
+	a.(eventSource).setEventBus(bus)
+
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Port() != 4242 {
+		t.Errorf("Port: got %d; expected published port 4242", a.Port())
+	}
+
+	timeout := time.After(5 * time.Second)
+	for logged := false; !logged; {
+		select {
+		case e := <-events:
+			logged = e.Type == EventLog && strings.Contains(e.Data, "container ready")
+		case <-timeout:
+			t.Fatal("Container logs not published")
+		}
+	}
+
+	if err := a.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	log, _ := ioutil.ReadFile(path.Join(dir, "docker.log"))
+	for _, cmd := range []string{"compose -f docker-compose.yml up -d", "compose -f docker-compose.yml down"} {
+		if !strings.Contains(string(log), cmd) {
+			t.Errorf("docker not called with: %s", cmd)
+		}
+	}
+}
+
+func TestComposeAppCrash(t *testing.T) {
+	defer func(d time.Duration) { composeInterval = d }(composeInterval)
+	composeInterval = 50 * time.Millisecond
+
+	a, dir := newTestComposeApp(t)
+	defer os.RemoveAll(dir)
+
+	bus := NewEventBus()
+	events := bus.Subscribe()
+	defer bus.Unsubscribe(events)
+	a.(eventSource).setEventBus(bus)
+
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(path.Join(dir, "running"))
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			if e.Type != EventCrashed {
+				continue
+			}
+
+			if a.State() != Crashed {
+				t.Errorf("State: got %s; expected %s", a.State(), Crashed)
+			}
+
+			if a.(*composeApp).logs != nil {
+				t.Error("Logs should not be followed after a crash")
+			}
+
+			log, _ := ioutil.ReadFile(path.Join(dir, "docker.log"))
+			if !strings.Contains(string(log), "compose -f docker-compose.yml down") {
+				t.Error("Remaining containers should be taken down after a crash")
+			}
+			return
+
+		case <-timeout:
+			t.Fatal("Exited containers not detected")
+		}
+	}
+}
+
+func TestComposeAppNotConfigured(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = NewComposeApp(path.Join(dir, "compose.yaml"), defaultDocker)
+	if err != errComposeNotConfigured {
+		t.Errorf("Error: got %v; expected %v", err, errComposeNotConfigured)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// csrfField is the form field, and csrfHeader the header, carrying the
+// token of the command center's actions.
+const (
+	csrfField  = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+)
+
+// newCSRFToken returns a random token, which the pages of the command
+// center send back along with every action changing an application.
+func newCSRFToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("Unable to generate the CSRF token: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// checkCSRF tells whether r is an action sent by a page of the command
+// center: a POST to one of its own hosts, from one of its pages and
+// carrying its token. Otherwise, the error is rendered and false is
+// returned.
+func (cc *CommandCenter) checkCSRF(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		cc.renderError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method not allowed: %s", r.Method))
+		return false
+	}
+
+	err := cc.checkOrigin(r)
+	if err == nil {
+		err = cc.checkToken(r)
+	}
+	if err != nil {
+		cc.renderError(w, http.StatusForbidden, err)
+		return false
+	}
+	return true
+}
+
+// checkOrigin rejects requests to hosts other than the command center's,
+// which a DNS rebinding would send, and requests from other sites.
+func (cc *CommandCenter) checkOrigin(r *http.Request) error {
+	if !cc.ownHost(r.Host) {
+		return fmt.Errorf("Invalid host: %s", r.Host)
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+
+	if origin == "" {
+		return nil
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || !strings.EqualFold(u.Host, r.Host) {
+		return fmt.Errorf("Cross-origin request from %s", origin)
+	}
+	return nil
+}
+
+// checkToken compares the token of r with the command center's.
+func (cc *CommandCenter) checkToken(r *http.Request) error {
+	token := r.Header.Get(csrfHeader)
+	if token == "" {
+		token = r.PostFormValue(csrfField)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(token), []byte(cc.csrfToken)) != 1 {
+		return fmt.Errorf("Invalid CSRF token, please reload the page")
+	}
+	return nil
+}
+
+// ownHost reports whether host, with or without port, names the command
+// center: its own domain, its xip.io domain, or the local host.
+func (cc *CommandCenter) ownHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+
+	if host == "localhost" {
+		return true
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback()
+	}
+
+	if xipio.MatchString(host) {
+		return xipio.ReplaceAllString(host, "$1") == strings.ToLower(cc.name)
+	}
+	return host == strings.ToLower(cc.name+"."+cc.tld)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// postAction sends the action at target to cc as its pages do.
+func postAction(cc *CommandCenter, target string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", target, nil)
+	r.Host = "bam.app"
+	r.Header.Set("Origin", "http://bam.app")
+	r.Header.Set(csrfHeader, cc.csrfToken)
+	w := httptest.NewRecorder()
+	cc.handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestCSRF(t *testing.T) {
+	cc := NewCommandCenter("bam", &Config{AppsDir: "./examples/", Tld: "app"})
+	static, _ := cc.app("static")
+	defer static.Stop()
+
+	form := url.Values{csrfField: {cc.csrfToken}}.Encode()
+	tests := []struct {
+		method, host, origin, token string
+		status                      int
+	}{
+		{"GET", "bam.app", "", cc.csrfToken, http.StatusMethodNotAllowed},
+		{"POST", "bam.app", "", "", http.StatusForbidden},
+		{"POST", "bam.app", "", "invalid", http.StatusForbidden},
+		{"POST", "bam.app", "http://evil.com", cc.csrfToken, http.StatusForbidden},
+		{"POST", "evil.com", "http://evil.com", cc.csrfToken, http.StatusForbidden},
+		{"POST", "bam.192.168.1.15.xip.io.evil.com", "", cc.csrfToken, http.StatusForbidden},
+		{"POST", "bam.app", "http://bam.app", cc.csrfToken, http.StatusFound},
+		{"POST", "localhost:42042", "", cc.csrfToken, http.StatusFound},
+		{"POST", "bam.192.168.1.15.xip.io", "http://bam.192.168.1.15.xip.io", cc.csrfToken, http.StatusFound},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/all/stop", nil)
+		r.Host = tt.host
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if tt.token != "" {
+			r.Header.Set(csrfHeader, tt.token)
+		}
+
+		w := httptest.NewRecorder()
+		cc.handler.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s %s from %q: got %d; expected %d", tt.method, tt.host, tt.origin, w.Code, tt.status)
+		}
+	}
+
+	r := httptest.NewRequest("POST", "/apps/static/start", strings.NewReader(form))
+	r.Host = "bam.app"
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Referer", "http://bam.app/")
+	w := httptest.NewRecorder()
+	cc.handler.ServeHTTP(w, r)
+	if w.Code != http.StatusFound || !static.Running() {
+		t.Errorf("Form with token: got %d; expected %d", w.Code, http.StatusFound)
+	}
+
+	w = httptest.NewRecorder()
+	cc.handler.ServeHTTP(w, httptest.NewRequest("GET", "/apps/static", nil))
+	if !strings.Contains(w.Body.String(), `value="`+cc.csrfToken+`"`) || !strings.Contains(w.Body.String(), `method="post"`) {
+		t.Errorf("Application page should post its actions along with the token")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// readyTimeout is how long to wait for a dependency to accept connections.
+var readyTimeout = 30 * time.Second
+
+// dependent is implemented by applications requiring other applications
+// to be running before they start.
+type dependent interface {
+	Dependencies() []string
+}
+
+// dependencies returns the names of the applications required by a.
+func dependencies(a App) []string {
+	if d, ok := unwrap(a).(dependent); ok {
+		return d.Dependencies()
+	}
+	return nil
+}
+
+// dependencyOrder returns the application called name preceded by all of
+// its transitive dependencies, each one after the applications it depends on.
+func dependencyOrder(name string, get func(string) (App, bool)) ([]App, error) {
+	order := []App{}
+	visited := make(map[string]bool)
+	path := []string{}
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		key := strings.ToLower(name)
+		if visited[key] {
+			return nil
+		}
+
+		for i, n := range path {
+			if strings.ToLower(n) == key {
+				cycle := append(path[i:], name)
+				return fmt.Errorf("Dependency cycle: %s", strings.Join(cycle, " -> "))
+			}
+		}
+
+		a, ok := get(name)
+		if !ok {
+			if len(path) == 0 {
+				return fmt.Errorf("Application doesn't exist: %s", name)
+			}
+			return fmt.Errorf("Application %s depends on unknown application %s", path[len(path)-1], name)
+		}
+
+		path = append(path, name)
+		for _, dep := range dependencies(a) {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+
+		visited[key] = true
+		order = append(order, a)
+		return nil
+	}
+
+	err := visit(name)
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// waitReady waits until a is running and accepting connections.
+func waitReady(a App, timeout time.Duration) error {
+	network, address := appAddr(a)
+	deadline := time.Now().Add(timeout)
+	for {
+		switch a.State() {
+		case Running:
+			conn, err := net.DialTimeout(network, address, time.Second)
+			if err == nil {
+				conn.Close()
+				return nil
+			}
+
+		case Stopped, Crashed:
+			return fmt.Errorf("%s is %s", a.Name(), a.State())
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out waiting for %s to be ready", a.Name())
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDependencyOrder(t *testing.T) {
+	apps := map[string]App{}
+	add := func(name string, deps ...string) {
+		a := &fakeApp{}
+		a.name = name
+		a.dependsOn = deps
+		apps[name] = a
+	}
+	get := func(name string) (App, bool) {
+		a, ok := apps[name]
+		return a, ok
+	}
+
+	add("frontend", "api", "auth")
+	add("api", "db")
+	add("auth", "db")
+	add("db")
+	add("loop", "cycle")
+	add("cycle", "loop")
+	add("broken", "missing")
+
+	order, err := dependencyOrder("frontend", get)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, a := range order {
+		names = append(names, a.Name())
+	}
+
+	got := strings.Join(names, " ")
+	if got != "db api auth frontend" {
+		t.Errorf("Order: got %s; expected db api auth frontend", got)
+	}
+
+	_, err = dependencyOrder("loop", get)
+	if err == nil || !strings.Contains(err.Error(), "loop -> cycle -> loop") {
+		t.Errorf("Cycle not reported: %v", err)
+	}
+
+	_, err = dependencyOrder("broken", get)
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Unknown dependency not reported: %v", err)
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	a, err := NewWebServerApp("./examples/static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := waitReady(a, readyTimeout); err == nil {
+		t.Error("Stopped application should not be ready")
+	}
+
+	a.Start()
+	defer a.Stop()
+
+	if err := waitReady(a, readyTimeout); err != nil {
+		t.Error(err)
+	}
+}
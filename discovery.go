@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// siblingAware is implemented by applications which need to know the
+// other applications registered along with them.
+type siblingAware interface {
+	setSiblings(func() []App)
+}
+
+// localURL returns the address where a is listening on the local host,
+// or its upstream URL if it's elsewhere.
+func localURL(a App) string {
+	if u, ok := unwrap(a).(upstreamer); ok {
+		return u.Upstream().String()
+	}
+	if socket, ok := appSocket(a); ok {
+		return "unix://" + socket
+	}
+	return fmt.Sprintf("http://localhost:%d", a.Port())
+}
+
+// reachable tells whether a has an address to be reached at: aliases
+// always have one, other applications only while running, as stopped
+// ones keep their last port.
+func reachable(a App) bool {
+	if isAlias(a) {
+		return true
+	}
+	if !a.Running() {
+		return false
+	}
+	if _, ok := appSocket(a); ok {
+		return true
+	}
+	return a.Port() > 0
+}
+
+// envName converts an application name to be used in environment
+// variable names, like BAM_MY_API_URL for the application my-api.
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return '_'
+		}
+		return unicode.ToUpper(r)
+	}, name)
+}
+
+// discoveryEnv returns BAM_<APP>_URL and BAM_<APP>_PORT variables for
+// every reachable application in apps but self. Upstream aliases only get
+// BAM_<APP>_URL, and applications listening on unix sockets get
+// BAM_<APP>_SOCKET instead of BAM_<APP>_PORT.
+func discoveryEnv(self string, apps []App) []string {
+	env := []string{}
+	for _, a := range apps {
+		if strings.EqualFold(a.Name(), self) || !reachable(a) {
+			continue
+		}
+
+		name := envName(a.Name())
+		if _, ok := unwrap(a).(upstreamer); ok {
+			env = append(env, fmt.Sprintf("BAM_%s_URL=%s", name, localURL(a)))
+			continue
+		}
+
+		if socket, ok := appSocket(a); ok {
+			env = append(env,
+				fmt.Sprintf("BAM_%s_URL=unix://%s", name, socket),
+				fmt.Sprintf("BAM_%s_SOCKET=%s", name, socket))
+			continue
+		}
+
+		env = append(env,
+			fmt.Sprintf("BAM_%s_URL=%s", name, localURL(a)),
+			fmt.Sprintf("BAM_%s_PORT=%d", name, a.Port()))
+	}
+	return env
+}
+
+// appRef matches values calling the app function of expandEnv.
+var appRef = regexp.MustCompile(`{{-?\s*app\s`)
+
+// expandEnv resolves {{app "name"}} references in the values of env to
+// the current URL of the named application. Only values calling app are
+// expanded, other values are kept as they are, braces included.
+// Applications which aren't running can't be resolved.
+func expandEnv(env []string, apps []App) ([]string, error) {
+	funcs := template.FuncMap{
+		"app": func(name string) (string, error) {
+			for _, a := range apps {
+				if !strings.EqualFold(a.Name(), name) {
+					continue
+				}
+
+				if !reachable(a) {
+					return "", fmt.Errorf("Application %s isn't running: start it first or add it to depends_on", a.Name())
+				}
+				return localURL(a), nil
+			}
+			return "", fmt.Errorf("Application doesn't exist: %s", name)
+		},
+	}
+
+	expanded := make([]string, len(env))
+	for i, v := range env {
+		if !appRef.MatchString(v) {
+			expanded[i] = v
+			continue
+		}
+
+		t, err := template.New("env").Funcs(funcs).Parse(v)
+		if err != nil {
+			return nil, err
+		}
+
+		b := &bytes.Buffer{}
+		err = t.Execute(b, nil)
+		if err != nil {
+			return nil, err
+		}
+		expanded[i] = b.String()
+	}
+	return expanded, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"api", "API"},
+		{"my-api", "MY_API"},
+		{"PyServer", "PYSERVER"},
+		{"web.v2", "WEB_V2"},
+	}
+
+	for _, tt := range tests {
+		if got := envName(tt.name); got != tt.expected {
+			t.Errorf("envName(%s): got %s; expected %s", tt.name, got, tt.expected)
+		}
+	}
+}
+
+// stoppedApp is a stopped application which keeps its last port.
+type stoppedApp struct {
+	fakeApp
+}
+
+func (a *stoppedApp) Running() bool { return false }
+func (a *stoppedApp) State() State  { return Stopped }
+
+func newStoppedApp(name string, port int) App {
+	a := &stoppedApp{}
+	a.name = name
+	a.port = port
+	return a
+}
+
+func TestDiscoveryEnv(t *testing.T) {
+	apps := []App{newApp("api", 3000), newApp("auth-server", 4000), newApp("web", 5000), newApp("idle", 0),
+		newStoppedApp("old", 6000)}
+
+	got := discoveryEnv("web", apps)
+	expected := []string{
+		"BAM_API_URL=http://localhost:3000",
+		"BAM_API_PORT=3000",
+		"BAM_AUTH_SERVER_URL=http://localhost:4000",
+		"BAM_AUTH_SERVER_PORT=4000",
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Environment: got %v; expected %v", got, expected)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	apps := []App{newApp("api", 3000), newApp("idle", 0), newStoppedApp("old", 6000)}
+
+	got, err := expandEnv([]string{"API_URL={{app \"api\"}}/v1", "DEBUG=1", "FORMAT={{.Name}} {{"}, apps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"API_URL=http://localhost:3000/v1", "DEBUG=1", "FORMAT={{.Name}} {{"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Environment: got %v; expected %v", got, expected)
+	}
+
+	_, err = expandEnv([]string{"AUTH_URL={{app \"auth\"}}"}, apps)
+	if err == nil {
+		t.Error("Unknown applications should not be resolved")
+	}
+
+	for _, name := range []string{"idle", "old"} {
+		_, err = expandEnv([]string{fmt.Sprintf("URL={{app %q}}", name)}, apps)
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("Applications which aren't running should not be resolved: %v", err)
+		}
+	}
+}
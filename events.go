@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType identifies a change in an application's lifecycle.
+type EventType string
+
+const (
+	EventRegistered EventType = "registered"
+	EventStarting   EventType = "starting"
+	EventReady      EventType = "ready"
+	EventStopped    EventType = "stopped"
+	EventCrashed    EventType = "crashed"
+	EventDown       EventType = "down"
+	EventShared     EventType = "shared"
+	EventUnshared   EventType = "unshared"
+	EventLog        EventType = "log"
+)
+
+// stateEvents maps states to the event published when an application enters them.
+var stateEvents = map[State]EventType{
+	Starting: EventStarting,
+	Running:  EventReady,
+	Stopped:  EventStopped,
+	Crashed:  EventCrashed,
+	Down:     EventDown,
+}
+
+// Event is something that happened to an application. ExitCode is only
+// set for crashed events of processes, even when they exited with code 0.
+type Event struct {
+	Type     EventType `json:"type"`
+	App      string    `json:"app"`
+	Data     string    `json:"data,omitempty"`
+	ExitCode *int      `json:"exit_code,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+func (e Event) String() string {
+	if e.Data == "" {
+		return fmt.Sprintf("[%s] %s", e.App, e.Type)
+	}
+	return fmt.Sprintf("[%s] %s: %s", e.App, e.Type, e.Data)
+}
+
+// eventBufferSize is how many events a subscriber may fall behind
+// before new events are dropped for it.
+const eventBufferSize = 256
+
+// EventBus delivers application events to all of its subscribers.
+// Slow subscribers miss events instead of blocking publishers.
+type EventBus struct {
+	mu   sync.RWMutex
+	subs map[chan Event]struct{}
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[chan Event]struct{})}
+}
+
+// Publish sends e to every subscriber. A nil EventBus discards events.
+func (b *EventBus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving all events published from now on.
+func (b *EventBus) Subscribe() <-chan Event {
+	ch := make(chan Event, eventBufferSize)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+// Unsubscribe stops the delivery of events to ch and closes it.
+func (b *EventBus) Unsubscribe(ch <-chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.subs {
+		if c == ch {
+			delete(b.subs, c)
+			close(c)
+			return
+		}
+	}
+}
+
+// logWriter publishes every line written to it as a log event.
+type logWriter struct {
+	mu      sync.Mutex
+	publish func(EventType, string)
+	buf     bytes.Buffer
+}
+
+func newLogWriter(publish func(EventType, string)) *logWriter {
+	return &logWriter{publish: publish}
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := string(w.buf.Next(i + 1))
+		w.publish(EventLog, strings.TrimRight(line, "\r\n"))
+	}
+	return len(p), nil
+}
+
+// writeEvent writes e to w using the Server-Sent Events format.
+func writeEvent(w io.Writer, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, b)
+	return err
+}
+
+// readEvents decodes a Server-Sent Events stream, calling fn for each event.
+func readEvents(r io.Reader, fn func(Event)) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		var e Event
+		err := json.Unmarshal([]byte(strings.TrimSpace(line[5:])), &e)
+		if err != nil {
+			return err
+		}
+		fn(e)
+	}
+	return s.Err()
+}
+
+// watchEvents prints the events streamed by the CommandCenter reachable
+// through the proxy at addr.
+func watchEvents(w io.Writer, addr, host string) error {
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://%s/events", addr), nil)
+	if err != nil {
+		return err
+	}
+	req.Host = host
+	req.Header.Set("Accept", "text/event-stream")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected response from %s: %s", host, res.Status)
+	}
+
+	return readEvents(res.Body, func(e Event) {
+		fmt.Fprintf(w, "%s %s\n", e.Time.Format("15:04:05"), e)
+	})
+}
+
+// eventSource is implemented by applications which publish their own
+// lifecycle events.
+type eventSource interface {
+	setEventBus(*EventBus)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+	a := bus.Subscribe()
+	b := bus.Subscribe()
+
+	bus.Publish(Event{Type: EventReady, App: "ping"})
+
+	for _, ch := range []<-chan Event{a, b} {
+		select {
+		case e := <-ch:
+			if e.Type != EventReady || e.App != "ping" {
+				t.Errorf("Unexpected event: %s", e)
+			}
+			if e.Time.IsZero() {
+				t.Error("Event time should be set on publish")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Event not delivered")
+		}
+	}
+
+	bus.Unsubscribe(a)
+	if _, ok := <-a; ok {
+		t.Error("Channel should be closed after unsubscribe")
+	}
+
+	for i := 0; i < eventBufferSize+1; i++ {
+		bus.Publish(Event{Type: EventLog, App: "ping"}) // must not block
+	}
+	bus.Unsubscribe(b)
+}
+
+func TestAppEvents(t *testing.T) {
+	bus := NewEventBus()
+	events := bus.Subscribe()
+	defer bus.Unsubscribe(events)
+
+	a, err := NewWebServerApp("./examples/static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.(eventSource).setEventBus(bus)
+	a.Start()
+	a.Stop()
+
+	expected := []EventType{EventStarting, EventReady, EventStopped}
+	for _, typ := range expected {
+		select {
+		case e := <-events:
+			if e.Type != typ {
+				t.Errorf("Event type: got %s; expected %s", e.Type, typ)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Event not published: %s", typ)
+		}
+	}
+}
+
+func TestLogWriter(t *testing.T) {
+	lines := []string{}
+	w := newLogWriter(func(typ EventType, line string) {
+		lines = append(lines, line)
+	})
+
+	w.Write([]byte("first\nsec"))
+	w.Write([]byte("ond\r\nthird"))
+
+	if len(lines) != 2 || lines[0] != "first" || lines[1] != "second" {
+		t.Errorf("Unexpected lines: %q", lines)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	code := 0
+	sent := []Event{
+		{Type: EventRegistered, App: "ping"},
+		{Type: EventShared, App: "ping", Data: "https://ping.example.com"},
+		{Type: EventCrashed, App: "ping", Data: "web exited with code 0", ExitCode: &code},
+	}
+
+	b := &bytes.Buffer{}
+	for _, e := range sent {
+		writeEvent(b, e)
+	}
+
+	received := []Event{}
+	err := readEvents(b, func(e Event) { received = append(received, e) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received) != len(sent) {
+		t.Fatalf("Event count: got %d; expected %d", len(received), len(sent))
+	}
+
+	for i, e := range received {
+		if e.Type != sent[i].Type || e.App != sent[i].App || e.Data != sent[i].Data {
+			t.Errorf("Event: got %s; expected %s", e, sent[i])
+		}
+	}
+
+	if code := received[2].ExitCode; code == nil || *code != 0 {
+		t.Errorf("Exit code 0 of crashed events should be kept: got %v", code)
+	}
+
+	if received[0].ExitCode != nil {
+		t.Errorf("Exit code of registered events: got %d; expected none", *received[0].ExitCode)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// categorized is implemented by applications whose settings may name
+// their group and tags.
+type categorized interface {
+	Group() string
+	Tags() []string
+}
+
+// AppGroup is a group of applications, as listed in the command center.
+// Applications without a group are listed in a group without a name.
+type AppGroup struct {
+	Name string
+	Apps []*ShareableApp
+}
+
+// AppFilter selects applications by group and tag. Empty fields match
+// anything.
+type AppFilter struct {
+	Group string
+	Tag   string
+}
+
+// groupDirs returns the directories inside dir which aren't applications
+// themselves, grouping the applications found inside them.
+func groupDirs(dir string) []string {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	dirs := []string{}
+	for _, e := range entries {
+		d := path.Join(dir, e.Name())
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") && !isAppDir(d) {
+			dirs = append(dirs, d)
+		}
+	}
+	return dirs
+}
+
+// isAppDir reports whether dir holds an application.
+func isAppDir(dir string) bool {
+	markers := append([]string{"Procfile", "index.html", appConfigFile}, composeFiles...)
+	for _, name := range markers {
+		if _, err := os.Stat(path.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// group returns the group of a: the one named in its settings or, without
+// it, the directory grouping it.
+func (cc *CommandCenter) group(a App) string {
+	if c, ok := unwrap(a).(categorized); ok && c.Group() != "" {
+		return c.Group()
+	}
+
+	cc.appsMu.RLock()
+	defer cc.appsMu.RUnlock()
+	return cc.dirGroups[strings.ToLower(a.Name())]
+}
+
+// tags returns the tags of a, sorted: the ones in its settings along with
+// the ones whose patterns in the configuration file match its name.
+func (cc *CommandCenter) tags(a App) []string {
+	set := make(map[string]bool)
+	if c, ok := unwrap(a).(categorized); ok {
+		for _, tag := range c.Tags() {
+			set[strings.ToLower(tag)] = true
+		}
+	}
+
+	for tag, patterns := range cc.tagPatterns {
+		if matchAny(patterns, a.Name()) {
+			set[strings.ToLower(tag)] = true
+		}
+	}
+
+	tags := []string{}
+	for tag := range set {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// AllTags returns the tags of all applications, sorted.
+func (cc *CommandCenter) AllTags() []string {
+	set := make(map[string]bool)
+	for _, app := range cc.Apps() {
+		for _, tag := range cc.tags(app) {
+			set[tag] = true
+		}
+	}
+
+	tags := []string{}
+	for tag := range set {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Match reports whether a is in the group and has the tag of f.
+func (cc *CommandCenter) match(f AppFilter, a App) bool {
+	if f.Group != "" && !strings.EqualFold(cc.group(a), f.Group) {
+		return false
+	}
+
+	if f.Tag != "" {
+		for _, tag := range cc.tags(a) {
+			if strings.EqualFold(tag, f.Tag) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// groupedApps returns the applications matching f by group, the ones
+// without a group first, and then the groups sorted by name.
+func (cc *CommandCenter) groupedApps(f AppFilter) []AppGroup {
+	byGroup := make(map[string][]*ShareableApp)
+	for _, app := range cc.Apps() {
+		if cc.match(f, app) {
+			g := cc.group(app)
+			byGroup[g] = append(byGroup[g], app)
+		}
+	}
+
+	names := []string{}
+	for name := range byGroup {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	groups := []AppGroup{}
+	for _, name := range names {
+		groups = append(groups, AppGroup{Name: name, Apps: byGroup[name]})
+	}
+	return groups
+}
+
+// Groups returns the applications of each group, by group name.
+func (cc *CommandCenter) Groups() map[string][]string {
+	groups := make(map[string][]string)
+	for _, g := range cc.groupedApps(AppFilter{}) {
+		if g.Name == "" {
+			continue
+		}
+
+		for _, app := range g.Apps {
+			groups[g.Name] = append(groups[g.Name], app.Name())
+		}
+	}
+	return groups
+}
+
+// StartGroups returns the names of the start groups, sorted.
+func (cc *CommandCenter) StartGroups() []string {
+	names := []string{}
+	for name := range cc.startGroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// groupApps returns the applications of the named start group or, if
+// there isn't one, of the named group.
+func (cc *CommandCenter) groupApps(name string) ([]*ShareableApp, error) {
+	apps := []*ShareableApp{}
+	if patterns, ok := cc.startGroups[name]; ok {
+		for _, app := range cc.Apps() {
+			if matchAny(patterns, app.Name()) {
+				apps = append(apps, app)
+			}
+		}
+
+		if len(apps) == 0 {
+			return nil, fmt.Errorf("No applications match %s", strings.Join(patterns, ", "))
+		}
+		return apps, nil
+	}
+
+	for _, app := range cc.Apps() {
+		if strings.EqualFold(cc.group(app), name) {
+			apps = append(apps, app)
+		}
+	}
+
+	if len(apps) == 0 {
+		return nil, fmt.Errorf("Group doesn't exist: %s", name)
+	}
+	return apps, nil
+}
+
+// startGroup starts the applications of the named group.
+func (cc *CommandCenter) startGroup(name string) error {
+	apps, err := cc.groupApps(name)
+	if err != nil {
+		return err
+	}
+	return cc.startApps(apps)
+}
+
+// stopGroup stops the running applications of the named group.
+func (cc *CommandCenter) stopGroup(name string) error {
+	apps, err := cc.groupApps(name)
+	if err != nil {
+		return err
+	}
+	return cc.stopApps(apps)
+}
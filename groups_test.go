@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestGroups(t *testing.T) {
+	dir := newTestDir(t, map[string]string{
+		"api/Procfile":             "web: sleep 10\n",
+		"shop/cart/index.html":     "cart",
+		"shop/front/index.html":    "front",
+		"tools/admin/index.html":   "admin",
+		"tools/admin/.bam.toml":    "group = \"ops\"\ntags = [\"Internal\"]\n",
+		".cache/hidden/index.html": "hidden",
+	})
+	defer os.RemoveAll(dir)
+
+	c := &Config{AppsDir: dir, Tld: "app", Tags: map[string][]string{"backend": {"api", "cart"}}}
+	cc := NewCommandCenter("bam", c)
+
+	if _, ok := cc.app("hidden"); ok {
+		t.Errorf("Applications in hidden folders should be ignored")
+	}
+
+	groups := cc.Groups()
+	if fmt.Sprint(groups) != "map[ops:[admin] shop:[cart front]]" {
+		t.Errorf("Groups: got %v", groups)
+	}
+
+	expected := map[string]string{"api": "[backend]", "cart": "[backend]", "front": "[]", "admin": "[internal]"}
+	for name, tags := range expected {
+		app, _ := cc.app(name)
+		if got := fmt.Sprint(cc.tags(app)); got != tags {
+			t.Errorf("%s tags: got %s; expected %s", name, got, tags)
+		}
+	}
+
+	if tags := cc.AllTags(); fmt.Sprint(tags) != "[backend internal]" {
+		t.Errorf("All tags: got %v", tags)
+	}
+
+	filtered := cc.groupedApps(AppFilter{Tag: "backend"})
+	if len(filtered) != 2 || filtered[0].Name != "" || filtered[1].Name != "shop" || len(filtered[1].Apps) != 1 {
+		t.Errorf("Filtered by tag: got %v", filtered)
+	}
+
+	if filtered := cc.groupedApps(AppFilter{Group: "Shop"}); len(filtered) != 1 || len(filtered[0].Apps) != 2 {
+		t.Errorf("Filtered by group: got %v", filtered)
+	}
+}
+
+func TestGroupsHandler(t *testing.T) {
+	dir := newTestDir(t, map[string]string{
+		"shop/cart/index.html":  "cart",
+		"shop/front/index.html": "front",
+		"other/index.html":      "other",
+	})
+	defer os.RemoveAll(dir)
+
+	cc := NewCommandCenter("bam", &Config{AppsDir: dir, Tld: "app"})
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		cc.handler.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		return w
+	}
+
+	w := get("/groups/")
+	var groups map[string][]string
+	if err := json.NewDecoder(w.Body).Decode(&groups); err != nil || fmt.Sprint(groups) != "map[shop:[cart front]]" {
+		t.Errorf("Groups: got %v (%v)", groups, err)
+	}
+
+	if w := postAction(cc, "/groups/shop/start"); w.Code != http.StatusFound {
+		t.Fatalf("Status code: got %d; expected %d", w.Code, http.StatusFound)
+	}
+
+	cart, _ := cc.app("cart")
+	front, _ := cc.app("front")
+	other, _ := cc.app("other")
+	defer cart.Stop()
+	defer front.Stop()
+	if !cart.Running() || !front.Running() || other.Running() {
+		t.Errorf("Only the applications of the group should be started")
+	}
+
+	body := get("/?group=shop").Body.String()
+	if !strings.Contains(body, `data-app="cart"`) || strings.Contains(body, `data-app="other"`) {
+		t.Errorf("Index should only list the applications of the group")
+	}
+
+	if w := postAction(cc, "/groups/shop/stop"); w.Code != http.StatusFound {
+		t.Fatalf("Status code: got %d; expected %d", w.Code, http.StatusFound)
+	}
+
+	if cart.Running() || front.Running() {
+		t.Errorf("The applications of the group should be stopped")
+	}
+
+	if w := postAction(cc, "/groups/missing/stop"); w.Code != http.StatusInternalServerError {
+		t.Errorf("Status code: got %d; expected %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestGroupsDuplicateNames(t *testing.T) {
+	dir := newTestDir(t, map[string]string{
+		"shop/api/index.html":  "shop",
+		"tools/api/index.html": "tools",
+	})
+	defer os.RemoveAll(dir)
+
+	out := &bytes.Buffer{}
+	log.SetOutput(out)
+	defer log.SetOutput(os.Stderr)
+
+	cc := NewCommandCenter("bam", &Config{AppsDir: dir, Tld: "app"})
+	if _, ok := cc.app("api"); !ok {
+		t.Fatal("One of the applications named api should be registered")
+	}
+
+	warning := out.String()
+	if !strings.Contains(warning, "WARN ignoring application api") ||
+		!strings.Contains(warning, path.Join(dir, "shop", "api")) ||
+		!strings.Contains(warning, path.Join(dir, "tools", "api")) {
+		t.Errorf("Skipped application should be reported with both paths: %q", warning)
+	}
+}
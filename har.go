@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// HAR is an HTTP Archive, as described at http://www.softwareishard.com/blog/har-12-spec/
+type HAR struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// newHAR archives requests, oldest first.
+func newHAR(requests []*Recording) *HAR {
+	h := &HAR{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: programName, Version: programVersion},
+		Entries: []harEntry{},
+	}}
+
+	for j := len(requests) - 1; j >= 0; j-- {
+		h.Log.Entries = append(h.Log.Entries, newHAREntry(requests[j]))
+	}
+	return h
+}
+
+func newHAREntry(rec *Recording) harEntry {
+	ms := float64(rec.Duration) / float64(time.Millisecond)
+	u := &url.URL{Scheme: "http", Host: rec.Host}
+	if ref, err := url.ParseRequestURI(rec.URL); err == nil {
+		u = u.ResolveReference(ref)
+	}
+
+	e := harEntry{
+		StartedDateTime: rec.Time.Format(time.RFC3339Nano),
+		Time:            ms,
+		Request: harRequest{
+			Method:      rec.Method,
+			URL:         u.String(),
+			HTTPVersion: rec.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(rec.RequestHeader),
+			QueryString: harQuery(u.Query()),
+			HeadersSize: -1,
+			BodySize:    rec.RequestBody.Size,
+		},
+		Response: harResponse{
+			Status:      rec.Status,
+			StatusText:  http.StatusText(rec.Status),
+			HTTPVersion: rec.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(rec.ResponseHeader),
+			Content: harContent{
+				Size:     rec.ResponseBody.Size,
+				MimeType: rec.ResponseHeader.Get("Content-Type"),
+			},
+			RedirectURL: rec.ResponseHeader.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    rec.ResponseBody.Size,
+		},
+		Timings: harTimings{Send: 0, Wait: ms, Receive: 0},
+	}
+
+	if rec.RequestBody.IsText() && rec.RequestBody.Size > 0 {
+		e.Request.PostData = &harPostData{
+			MimeType: rec.RequestHeader.Get("Content-Type"),
+			Text:     rec.RequestBody.Text(),
+		}
+	}
+
+	if rec.ResponseBody.IsText() {
+		e.Response.Content.Text = rec.ResponseBody.Text()
+	} else {
+		e.Response.Content.Text = base64.StdEncoding.EncodeToString(rec.ResponseBody.Data)
+		e.Response.Content.Encoding = "base64"
+	}
+	return e
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	return harNameValues(map[string][]string(h))
+}
+
+func harQuery(q url.Values) []harNameValue {
+	return harNameValues(map[string][]string(q))
+}
+
+func harNameValues(m map[string][]string) []harNameValue {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	nv := []harNameValue{}
+	for _, name := range names {
+		for _, v := range m[name] {
+			nv = append(nv, harNameValue{Name: name, Value: v})
+		}
+	}
+	return nv
+}
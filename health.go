@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// healthInterval is how often aliases are probed by default.
+var healthInterval = 5 * time.Second
+
+// probeTimeout bounds a single health probe.
+var probeTimeout = 2 * time.Second
+
+// healthChecked is implemented by applications whose health is probed.
+type healthChecked interface {
+	setHealthCheck(path string, interval time.Duration)
+}
+
+// isAlias tells whether a is an alias, for an application not managed by
+// bam, whose address doesn't depend on it being started.
+func isAlias(a App) bool {
+	_, ok := unwrap(a).(healthChecked)
+	return ok
+}
+
+// init sets where a is probed: a connection to address on network or, if
+// a health path is set, a request to it relative to base.
+func (a *aliasApp) init(network, address string, base *url.URL, transport http.RoundTripper) {
+	a.network = network
+	a.address = address
+	a.base = base
+	a.client = &http.Client{Transport: transport, Timeout: probeTimeout}
+	a.interval = healthInterval
+}
+
+// setHealthCheck makes a probe an HTTP path instead of its port, every
+// interval if greater than zero.
+func (a *aliasApp) setHealthCheck(path string, interval time.Duration) {
+	a.health = path
+	if interval > 0 {
+		a.interval = interval
+	}
+}
+
+// Start begins probing the alias. Starting an alias already being probed
+// probes it right away, failing if it's down.
+func (a *aliasApp) Start() error {
+	a.ops.Lock()
+	defer a.ops.Unlock()
+
+	a.mu.Lock()
+	done := a.done
+	a.mu.Unlock()
+
+	if done != nil {
+		if !a.check(done) {
+			return fmt.Errorf("%s is down", a.Name())
+		}
+		return nil
+	}
+
+	done = make(chan struct{})
+	a.mu.Lock()
+	a.done = done
+	a.mu.Unlock()
+
+	if a.State() != Running {
+		a.setState(Starting)
+	}
+	go a.monitor(done)
+	return nil
+}
+
+// Stop stops probing the alias.
+func (a *aliasApp) Stop() error {
+	a.ops.Lock()
+	defer a.ops.Unlock()
+
+	a.mu.Lock()
+	done := a.done
+	a.done = nil
+	a.mu.Unlock()
+
+	if done != nil {
+		close(done)
+	}
+	a.setState(Stopped)
+	return nil
+}
+
+func (a *aliasApp) Running() bool {
+	return a.State() == Running
+}
+
+func (a *aliasApp) monitor(done chan struct{}) {
+	t := time.NewTicker(a.interval)
+	defer t.Stop()
+
+	for {
+		a.check(done)
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// check probes the alias, updating its state unless it was stopped
+// meanwhile, and reports whether it's up.
+func (a *aliasApp) check(done chan struct{}) bool {
+	up := a.probe()
+	state := Down
+	if up {
+		state = Running
+	}
+
+	a.mu.Lock()
+	changed := a.done == done && a.state != state
+	if changed {
+		a.state = state
+	}
+	a.mu.Unlock()
+
+	if changed {
+		a.notify(state)
+	}
+	return up
+}
+
+// probe reports whether the alias accepts connections or, if a health
+// path is set, answers it with a status below 400.
+func (a *aliasApp) probe() bool {
+	if a.health == "" {
+		conn, err := net.DialTimeout(a.network, a.address, probeTimeout)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+
+	res, err := a.client.Get(a.base.ResolveReference(&url.URL{Path: a.health}).String())
+	if err != nil {
+		return false
+	}
+	res.Body.Close()
+	return res.StatusCode < 400
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func waitState(a App, s State, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if a.State() == s {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return a.State() == s
+}
+
+func TestAliasHealthPort(t *testing.T) {
+	s := httptest.NewServer(http.NotFoundHandler())
+	port := getServerPort(t, s.URL)
+
+	a := NewAliasApp("btsync", port)
+	a.(healthChecked).setHealthCheck("", 20*time.Millisecond)
+
+	bus := NewEventBus()
+	events := bus.Subscribe()
+	defer bus.Unsubscribe(events)
+	a.(eventSource).setEventBus(bus)
+
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Stop()
+
+	if !waitState(a, Running, time.Second) {
+		t.Errorf("State: got %s; expected %s", a.State(), Running)
+	}
+
+	s.Close()
+	if !waitState(a, Down, time.Second) {
+		t.Errorf("State: got %s; expected %s", a.State(), Down)
+	}
+
+	if a.Running() {
+		t.Errorf("A down alias should not be running")
+	}
+
+	select {
+	case e := <-events:
+		if e.Type != EventDown || e.App != "btsync" {
+			t.Errorf("Event: got %s; expected btsync down", e)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected a down event")
+	}
+
+	if err := a.Start(); err == nil {
+		t.Errorf("Starting a down alias should fail")
+	}
+
+	a.Stop()
+	if a.State() != Stopped {
+		t.Errorf("State: got %s; expected %s", a.State(), Stopped)
+	}
+}
+
+func TestAliasHealthPath(t *testing.T) {
+	var healthy int32 = 1
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer s.Close()
+
+	a, err := newAlias("staging", map[string]interface{}{
+		"url":      s.URL + "/api",
+		"health":   "/healthz",
+		"interval": "20ms",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Stop()
+
+	if !waitState(a, Running, time.Second) {
+		t.Errorf("State: got %s; expected %s", a.State(), Running)
+	}
+
+	atomic.StoreInt32(&healthy, 0)
+	if !waitState(a, Down, time.Second) {
+		t.Errorf("State: got %s; expected %s", a.State(), Down)
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+	if !waitState(a, Running, time.Second) {
+		t.Errorf("State: got %s; expected %s", a.State(), Running)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// hookError reports a failed hook along with its output.
+type hookError struct {
+	hook   string
+	output string
+	err    error
+}
+
+func (e *hookError) Error() string {
+	return fmt.Sprintf("%s hook failed: %v\n%s", e.hook, e.err, e.output)
+}
+
+// runHook runs command through the shell in dir with env added to bam's
+// environment. The output is copied to out and kept for error reporting.
+func runHook(name, command, dir string, env []string, out io.Writer) error {
+	if command == "" {
+		return nil
+	}
+
+	b := &bytes.Buffer{}
+	w := io.MultiWriter(b, out)
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = w
+	cmd.Stderr = w
+
+	err := cmd.Run()
+	if err != nil {
+		return &hookError{hook: name, output: b.String(), err: err}
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// InspectorConfig sets how many requests are kept for each application,
+// and the size limit of the bodies kept. Requests set to zero disables
+// the inspector.
+type InspectorConfig struct {
+	Requests int `toml:"requests"`
+	MaxBody  int `toml:"max_body"`
+}
+
+// Recording is a request proxied to an application, and its response.
+type Recording struct {
+	ID       int
+	App      string
+	Time     time.Time
+	Duration time.Duration
+
+	Method        string
+	Host          string
+	URL           string
+	Proto         string
+	RequestHeader http.Header
+	RequestBody   body
+
+	Status         int
+	ResponseHeader http.Header
+	ResponseBody   body
+}
+
+// body is the beginning of a request or response body.
+type body struct {
+	Data      []byte
+	Size      int64
+	Truncated bool
+}
+
+// IsText reports whether the body is text, rather than binary data.
+func (b body) IsText() bool {
+	return utf8.Valid(b.Data)
+}
+
+func (b body) Text() string {
+	return string(b.Data)
+}
+
+// Inspector keeps the last requests proxied to each application.
+// A nil Inspector keeps nothing.
+type Inspector struct {
+	mu       sync.RWMutex
+	size     int
+	maxBody  int
+	lastID   int
+	requests map[string][]*Recording
+	proxy    http.Handler
+}
+
+func NewInspector(c InspectorConfig) *Inspector {
+	if c.Requests <= 0 {
+		return nil
+	}
+
+	return &Inspector{
+		size:     c.Requests,
+		maxBody:  c.MaxBody,
+		requests: make(map[string][]*Recording),
+	}
+}
+
+// serve sends the request r to app through next, recording both the
+// request and its response.
+func (i *Inspector) serve(app string, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	rec := &Recording{
+		App:           app,
+		Time:          time.Now(),
+		Method:        r.Method,
+		Host:          r.Host,
+		URL:           r.URL.RequestURI(),
+		Proto:         r.Proto,
+		RequestHeader: cloneHeader(r.Header),
+	}
+
+	var rb *bodyRecorder
+	if r.Body != nil {
+		rb = &bodyRecorder{ReadCloser: r.Body, capture: capture{max: i.maxBody}}
+		r.Body = rb
+	}
+
+	rw := &responseRecorder{ResponseWriter: w, capture: capture{max: i.maxBody}}
+	next.ServeHTTP(rw, r)
+
+	rec.Duration = time.Since(rec.Time)
+	if rb != nil {
+		rec.RequestBody = rb.body()
+	}
+	rec.Status = rw.status
+	if rec.Status == 0 {
+		rec.Status = http.StatusOK
+	}
+	rec.ResponseHeader = cloneHeader(rw.Header())
+	rec.ResponseBody = rw.body()
+	i.add(rec)
+}
+
+func (i *Inspector) add(rec *Recording) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.lastID++
+	rec.ID = i.lastID
+	key := strings.ToLower(rec.App)
+	requests := append(i.requests[key], rec)
+	if len(requests) > i.size {
+		requests = requests[len(requests)-i.size:]
+	}
+	i.requests[key] = requests
+}
+
+// Requests returns the requests kept for app, newest first.
+func (i *Inspector) Requests(app string) []*Recording {
+	if i == nil {
+		return nil
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	requests := i.requests[strings.ToLower(app)]
+	list := make([]*Recording, len(requests))
+	for j, rec := range requests {
+		list[len(requests)-1-j] = rec
+	}
+	return list
+}
+
+// Request returns the request of app identified by id.
+func (i *Inspector) Request(app string, id int) (*Recording, bool) {
+	for _, rec := range i.Requests(app) {
+		if rec.ID == id {
+			return rec, true
+		}
+	}
+	return nil, false
+}
+
+// replayTimeout bounds how long a replayed request waits for the
+// application.
+var replayTimeout = 30 * time.Second
+
+// Replay sends rec again through the proxy. The new request is recorded
+// as any other.
+func (i *Inspector) Replay(rec *Recording) error {
+	if i == nil || i.proxy == nil {
+		return fmt.Errorf("Replay unavailable")
+	}
+
+	if rec.RequestBody.Truncated {
+		return fmt.Errorf("Request body was truncated at %d bytes", len(rec.RequestBody.Data))
+	}
+
+	r, err := http.NewRequest(rec.Method, "http://"+rec.Host+rec.URL, bytes.NewReader(rec.RequestBody.Data))
+	if err != nil {
+		return err
+	}
+	r.Header = cloneHeader(rec.RequestHeader)
+	r.Host = rec.Host
+	r.RequestURI = rec.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), replayTimeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	i.proxy.ServeHTTP(&discardWriter{header: make(http.Header)}, r)
+	return nil
+}
+
+// RequestFilter selects requests by method, path and status, like 404
+// or 4xx. Empty fields match anything.
+type RequestFilter struct {
+	Method string
+	Path   string
+	Status string
+}
+
+func (f RequestFilter) Match(rec *Recording) bool {
+	if f.Method != "" && !strings.EqualFold(f.Method, rec.Method) {
+		return false
+	}
+
+	if f.Path != "" && !strings.Contains(rec.URL, f.Path) {
+		return false
+	}
+
+	status := strconv.Itoa(rec.Status)
+	if s := strings.ToLower(f.Status); s != "" {
+		if strings.HasSuffix(s, "xx") {
+			return strings.HasPrefix(status, strings.TrimSuffix(s, "xx"))
+		}
+		return status == s
+	}
+	return true
+}
+
+// Filter returns the requests matching f.
+func (f RequestFilter) Filter(requests []*Recording) []*Recording {
+	matched := []*Recording{}
+	for _, rec := range requests {
+		if f.Match(rec) {
+			matched = append(matched, rec)
+		}
+	}
+	return matched
+}
+
+// capture keeps up to max bytes of a body, counting its size.
+type capture struct {
+	max  int
+	mu   sync.Mutex
+	data []byte
+	size int64
+}
+
+func (b *capture) record(p []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.size += int64(len(p))
+	if room := b.max - len(b.data); room > 0 {
+		if len(p) > room {
+			p = p[:room]
+		}
+		b.data = append(b.data, p...)
+	}
+}
+
+func (b *capture) body() body {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return body{Data: b.data, Size: b.size, Truncated: b.size > int64(len(b.data))}
+}
+
+// bodyRecorder records a request body while it's read.
+type bodyRecorder struct {
+	io.ReadCloser
+	capture
+}
+
+func (b *bodyRecorder) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.record(p[:n])
+	return n, err
+}
+
+// responseRecorder records the status and body of a response while
+// writing it.
+type responseRecorder struct {
+	http.ResponseWriter
+	capture
+	status int
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.record(p[:n])
+	return n, err
+}
+
+func (w *responseRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// discardWriter is a ResponseWriter for replayed requests, whose
+// responses are only recorded.
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+func cloneHeader(h http.Header) http.Header {
+	c := make(http.Header, len(h))
+	for k, v := range h {
+		c[k] = append([]string(nil), v...)
+	}
+	return c
+}
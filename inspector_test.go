@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInspector(t *testing.T) {
+	var hits int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Echo", "yes")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "echo %s", body)
+	}))
+	defer s.Close()
+
+	i := NewInspector(InspectorConfig{Requests: 2, MaxBody: 8})
+	p := NewProxy(newAppCenter([]App{newApp("myapp", getServerPort(t, s.URL))}), "local")
+	p.Inspect(i)
+	proxy := httptest.NewServer(p)
+	defer proxy.Close()
+
+	post := func(body string) {
+		req, _ := http.NewRequest("POST", proxy.URL+"/hooks?id=1", strings.NewReader(body))
+		req.Host = "myapp.local"
+		req.Close = true
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(res.Body)
+		res.Body.Close()
+	}
+
+	post("first")
+	post("second")
+	post("a long third body")
+
+	requests := i.Requests("myapp")
+	if len(requests) != 2 {
+		t.Fatalf("Requests: got %d; expected 2", len(requests))
+	}
+
+	rec := requests[0]
+	if rec.Method != "POST" || rec.URL != "/hooks?id=1" || rec.Status != http.StatusCreated {
+		t.Errorf("Request: got %s %s %d; expected POST /hooks?id=1 201", rec.Method, rec.URL, rec.Status)
+	}
+
+	if rec.RequestBody.Text() != "a long t" || !rec.RequestBody.Truncated || rec.RequestBody.Size != 17 {
+		t.Errorf("Request body: got %q (%d bytes)", rec.RequestBody.Text(), rec.RequestBody.Size)
+	}
+
+	if rec.ResponseBody.Text() != "echo a l" || rec.ResponseHeader.Get("X-Echo") != "yes" {
+		t.Errorf("Response: got %q %v", rec.ResponseBody.Text(), rec.ResponseHeader)
+	}
+
+	if requests[1].RequestBody.Text() != "second" || requests[1].RequestBody.Truncated {
+		t.Errorf("Request body: got %q; expected second", requests[1].RequestBody.Text())
+	}
+
+	if err := i.Replay(rec); err == nil {
+		t.Errorf("Truncated requests should not be replayed")
+	}
+
+	if err := i.Replay(requests[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := atomic.LoadInt32(&hits); n != 4 {
+		t.Errorf("Hits: got %d; expected 4", n)
+	}
+
+	if replayed := i.Requests("myapp")[0]; replayed.RequestBody.Text() != "second" || replayed.ID <= rec.ID {
+		t.Errorf("Replayed request not recorded: %+v", replayed)
+	}
+}
+
+func TestInspectorSkipsCommandCenter(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "command center")
+	}))
+	defer s.Close()
+
+	ac := &fakeAppCenter{apps: make(map[string]App)}
+	ac.name = "bam"
+	ac.port = getServerPort(t, s.URL)
+	ac.apps["bam"] = ac
+
+	i := NewInspector(InspectorConfig{Requests: 2})
+	p := NewProxy(ac, "local")
+	p.Inspect(i)
+	proxy := httptest.NewServer(p)
+	defer proxy.Close()
+
+	req, _ := http.NewRequest("GET", proxy.URL+"/", nil)
+	req.Host = "bam.local"
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	if requests := i.Requests("bam"); len(requests) != 0 {
+		t.Errorf("Command center requests should not be recorded: got %d", len(requests))
+	}
+}
+
+func TestInspectorReplayTimeout(t *testing.T) {
+	defer func(d time.Duration) { replayTimeout = d }(replayTimeout)
+	replayTimeout = 100 * time.Millisecond
+
+	done := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer s.Close()
+	defer close(done)
+
+	i := NewInspector(InspectorConfig{Requests: 2})
+	p := NewProxy(newAppCenter([]App{newApp("myapp", getServerPort(t, s.URL))}), "local")
+	p.Inspect(i)
+
+	rec := &Recording{Method: "GET", Host: "myapp.local", URL: "/slow", RequestHeader: make(http.Header)}
+	replayed := make(chan error, 1)
+	go func() { replayed <- i.Replay(rec) }()
+
+	select {
+	case <-replayed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Replay should give up on a hung application")
+	}
+}
+
+func TestRequestFilter(t *testing.T) {
+	requests := []*Recording{
+		{ID: 1, Method: "GET", URL: "/users", Status: 200},
+		{ID: 2, Method: "POST", URL: "/users", Status: 201},
+		{ID: 3, Method: "GET", URL: "/missing", Status: 404},
+		{ID: 4, Method: "POST", URL: "/hooks", Status: 500},
+	}
+
+	tests := []struct {
+		filter RequestFilter
+		ids    []int
+	}{
+		{RequestFilter{}, []int{1, 2, 3, 4}},
+		{RequestFilter{Method: "post"}, []int{2, 4}},
+		{RequestFilter{Path: "users"}, []int{1, 2}},
+		{RequestFilter{Status: "2xx"}, []int{1, 2}},
+		{RequestFilter{Status: "404"}, []int{3}},
+		{RequestFilter{Method: "POST", Status: "5XX"}, []int{4}},
+	}
+
+	for _, tt := range tests {
+		ids := []int{}
+		for _, rec := range tt.filter.Filter(requests) {
+			ids = append(ids, rec.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(tt.ids) {
+			t.Errorf("%+v: got %v; expected %v", tt.filter, ids, tt.ids)
+		}
+	}
+}
+
+func TestInspectorPages(t *testing.T) {
+	c := &Config{AppsDir: "./examples/", Tld: "app", Inspector: InspectorConfig{Requests: 10, MaxBody: 1024}}
+	cc := NewCommandCenter("bam", c)
+
+	app := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "<b>pong</b>")
+	})
+	req := httptest.NewRequest("GET", "http://static.app/ping?q=<x>", nil)
+	cc.inspector.serve("static", app, httptest.NewRecorder(), req)
+	rec := cc.inspector.Requests("static")[0]
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		cc.handler.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		return w
+	}
+
+	w := get("/apps/static/requests?status=2xx")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/ping?q=&lt;x&gt;") {
+		t.Errorf("Requests page: got %d %s", w.Code, w.Body)
+	}
+
+	w = get("/apps/static/requests?status=404")
+	if strings.Contains(w.Body.String(), "/ping") {
+		t.Errorf("Filtered requests page should not list /ping")
+	}
+
+	w = get(fmt.Sprintf("/apps/static/requests/%d", rec.ID))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "&lt;b&gt;pong&lt;/b&gt;") {
+		t.Errorf("Request page: got %d %s", w.Code, w.Body)
+	}
+
+	w = get("/apps/static/requests/12345")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Status code: got %d; expected %d", w.Code, http.StatusNotFound)
+	}
+
+	w = get("/apps/static/requests/har")
+	var har HAR
+	if err := json.Unmarshal(w.Body.Bytes(), &har); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(har.Log.Entries) != 1 {
+		t.Fatalf("HAR entries: got %d; expected 1", len(har.Log.Entries))
+	}
+
+	e := har.Log.Entries[0]
+	if e.Request.URL != "http://static.app/ping?q=<x>" {
+		t.Errorf("HAR URL: got %s", e.Request.URL)
+	}
+
+	if e.Response.Content.Text != "<b>pong</b>" || e.Response.Status != http.StatusOK {
+		t.Errorf("HAR response: got %d %s", e.Response.Status, e.Response.Content.Text)
+	}
+
+	if _, err := time.Parse(time.RFC3339Nano, e.StartedDateTime); err != nil {
+		t.Errorf("HAR startedDateTime: %v", err)
+	}
+}
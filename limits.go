@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// limits are the resources the processes of an application may use.
+// Zero means unlimited.
+type limits struct {
+	memory    int64 // bytes
+	cpu       int   // percentage of a CPU core
+	openFiles int
+}
+
+// limited is implemented by applications whose processes run under
+// resource limits.
+type limited interface {
+	// Limits describes the limits of the application.
+	Limits() string
+
+	// LimitKill explains why the application was killed for going over
+	// one of its limits, if it was.
+	LimitKill() string
+}
+
+// appLimits describes the limits of app, if it has any.
+func appLimits(app App) string {
+	if l, ok := unwrap(app).(limited); ok {
+		return l.Limits()
+	}
+	return ""
+}
+
+// limitKill explains why app was killed for going over its limits, if it was.
+func limitKill(app App) string {
+	if l, ok := unwrap(app).(limited); ok {
+		return l.LimitKill()
+	}
+	return ""
+}
+
+func parseLimits(c LimitsConfig) (limits, error) {
+	l := limits{cpu: c.CPU, openFiles: c.OpenFiles}
+	if c.CPU < 0 || c.OpenFiles < 0 {
+		return l, fmt.Errorf("Invalid limits: cpu=%d open_files=%d", c.CPU, c.OpenFiles)
+	}
+
+	if c.Memory != "" {
+		size, err := parseSize(c.Memory)
+		if err != nil {
+			return l, err
+		}
+		l.memory = size
+	}
+	return l, nil
+}
+
+// parseSize parses sizes like 512M or 2G, in binary units, into bytes.
+func parseSize(s string) (int64, error) {
+	units := map[string]int64{"": 1, "K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}
+
+	value := strings.ToUpper(strings.TrimSpace(s))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+	i := strings.IndexFunc(value, func(r rune) bool { return r < '0' || r > '9' })
+	if i < 0 {
+		i = len(value)
+	}
+
+	n, err := strconv.ParseInt(value[:i], 10, 64)
+	unit, ok := units[value[i:]]
+	if err != nil || !ok || n <= 0 {
+		return 0, fmt.Errorf("Invalid size: %s", s)
+	}
+	return n * unit, nil
+}
+
+func (l limits) empty() bool {
+	return l.memory == 0 && l.cpu == 0 && l.openFiles == 0
+}
+
+func (l limits) String() string {
+	desc := []string{}
+	if l.memory > 0 {
+		desc = append(desc, fmt.Sprintf("%s of memory", formatBytes(l.memory)))
+	}
+	if l.cpu > 0 {
+		desc = append(desc, fmt.Sprintf("%d%% of a CPU", l.cpu))
+	}
+	if l.openFiles > 0 {
+		desc = append(desc, fmt.Sprintf("%d open files", l.openFiles))
+	}
+	return strings.Join(desc, ", ")
+}
+
+// setup returns the shell commands run before each process, moving it into
+// cg, if any, and setting its rlimits. Without a cgroup the memory limit
+// caps the address space of each process, and the cpu limit is ignored.
+func (l limits) setup(cg *cgroup) string {
+	var b strings.Builder
+	if cg != nil {
+		fmt.Fprintf(&b, "echo $$ > %s || exit 1\n", shellQuote(cg.procs()))
+	} else if l.memory > 0 {
+		fmt.Fprintf(&b, "ulimit -v %d || exit 1\n", l.memory/1024)
+	}
+
+	if l.openFiles > 0 {
+		fmt.Fprintf(&b, "ulimit -n %d || exit 1\n", l.openFiles)
+	}
+	return b.String()
+}
+
+// explainKill explains whether a process terminated by signal was killed
+// for going over the memory limit, given the number of processes killed
+// by the out of memory killer of cg, if the limits were applied through it.
+func (l limits) explainKill(signal syscall.Signal, ooms int, cg *cgroup) string {
+	if l.memory == 0 {
+		return ""
+	}
+
+	if cg != nil {
+		if ooms > 0 {
+			return fmt.Sprintf("Killed for going over its memory limit of %s", formatBytes(l.memory))
+		}
+		return ""
+	}
+
+	switch signal {
+	case syscall.SIGKILL, syscall.SIGSEGV, syscall.SIGABRT, syscall.SIGBUS:
+		return fmt.Sprintf("Terminated by signal %d (%s), probably for going over its memory limit of %s",
+			signal, signal, formatBytes(l.memory))
+	}
+	return ""
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
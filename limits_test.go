@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size     string
+		expected int64
+	}{
+		{"1024", 1024},
+		{"64K", 64 << 10},
+		{"512M", 512 << 20},
+		{"512mb", 512 << 20},
+		{"2GiB", 2 << 30},
+		{"1T", 1 << 40},
+	}
+
+	for _, tt := range tests {
+		n, err := parseSize(tt.size)
+		if err != nil || n != tt.expected {
+			t.Errorf("%s: got %d (%v); expected %d", tt.size, n, err, tt.expected)
+		}
+	}
+
+	for _, size := range []string{"", "M", "-1G", "12X", "1.5G"} {
+		if _, err := parseSize(size); err == nil {
+			t.Errorf("%s: expected an error", size)
+		}
+	}
+}
+
+func TestLimitsSetup(t *testing.T) {
+	l := limits{memory: 512 << 20, cpu: 50, openFiles: 1024}
+
+	expected := "ulimit -v 524288 || exit 1\nulimit -n 1024 || exit 1\n"
+	if setup := l.setup(nil); setup != expected {
+		t.Errorf("Setup: got %q; expected %q", setup, expected)
+	}
+
+	expected = "echo $$ > '/sys/fs/cgroup/app-it'\\''s/cgroup.procs' || exit 1\nulimit -n 1024 || exit 1\n"
+	if setup := l.setup(&cgroup{dir: "/sys/fs/cgroup/app-it's"}); setup != expected {
+		t.Errorf("Setup: got %q; expected %q", setup, expected)
+	}
+
+	if setup := (limits{}).setup(nil); setup != "" {
+		t.Errorf("Setup: got %q; expected nothing", setup)
+	}
+
+	if desc := l.String(); desc != "512.0 MiB of memory, 50% of a CPU, 1024 open files" {
+		t.Errorf("Limits: got %s", desc)
+	}
+}
+
+func TestExplainKill(t *testing.T) {
+	l := limits{memory: 256 << 20}
+	cg := &cgroup{dir: "/sys/fs/cgroup/app-test"}
+
+	tests := []struct {
+		limits   limits
+		signal   syscall.Signal
+		ooms     int
+		cgroup   *cgroup
+		expected string
+	}{
+		{l, syscall.SIGKILL, 1, cg, "Killed for going over its memory limit of 256.0 MiB"},
+		{l, syscall.SIGKILL, 0, cg, ""},
+		{l, syscall.SIGKILL, 0, nil, "Terminated by signal 9 (killed), probably for going over its memory limit of 256.0 MiB"},
+		{l, syscall.SIGTERM, 0, nil, ""},
+		{l, 0, 0, nil, ""},
+		{limits{openFiles: 10}, syscall.SIGKILL, 0, nil, ""},
+	}
+
+	for i, tt := range tests {
+		if got := tt.limits.explainKill(tt.signal, tt.ooms, tt.cgroup); got != tt.expected {
+			t.Errorf("%d: got %q; expected %q", i, got, tt.expected)
+		}
+	}
+}
+
+func TestProcessAppLimits(t *testing.T) {
+	a, dir := newTestProcessApp(t, map[string]string{
+		"Procfile":  "web: ulimit -n > $PS.nofile; sleep 10\n",
+		".bam.toml": "[limits]\nopen_files = 64\n",
+	})
+	defer os.RemoveAll(dir)
+
+	if desc := appLimits(a); desc != "64 open files" {
+		t.Errorf("Limits: got %s; expected 64 open files", desc)
+	}
+
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Stop()
+
+	<-time.After(300 * time.Millisecond) // wait for the process to write its limit
+
+	content, _ := ioutil.ReadFile(path.Join(dir, "web.1.nofile"))
+	if strings.TrimSpace(string(content)) != "64" {
+		t.Errorf("Open files limit: got %q; expected 64", content)
+	}
+
+	if _, err := parseLimits(LimitsConfig{Memory: "lots"}); err == nil {
+		t.Errorf("Invalid limits should be rejected")
+	}
+}
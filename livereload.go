@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// liveReloadPath is where live reloading sites serve the reload script and
+// the stream of changes, on their own host.
+const liveReloadPath = "/__bam/livereload"
+
+// liveReloadInterval is how often the files of live reloading sites are
+// checked for changes.
+var liveReloadInterval = 500 * time.Millisecond
+
+const liveReloadScript = `(function() {
+  var source = new EventSource('` + liveReloadPath + `');
+  source.addEventListener('reload', function() {
+    location.reload();
+  });
+  source.addEventListener('css', function() {
+    var links = document.querySelectorAll('link[rel="stylesheet"]');
+    for (var i = 0; i < links.length; i++) {
+      var href = links[i].href.replace(/[?&]bamreload=\d+$/, '');
+      links[i].href = href + (href.indexOf('?') < 0 ? '?' : '&') + 'bamreload=' + Date.now();
+    }
+  });
+})();
+`
+
+var liveReloadTag = []byte(`<script src="` + liveReloadPath + `.js"></script>`)
+
+// watcher is implemented by handlers watching files while their
+// application is running.
+type watcher interface {
+	watch()
+	unwatch()
+}
+
+// liveReload watches the files of a site and tells the connected browsers
+// to reload the page, or just the stylesheets if only they have changed.
+type liveReload struct {
+	root    string
+	mu      sync.Mutex
+	clients map[chan string]bool
+	done    chan struct{}
+}
+
+func newLiveReload(root string) *liveReload {
+	return &liveReload{root: root, clients: make(map[chan string]bool)}
+}
+
+func (lr *liveReload) watch() {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	if lr.done != nil {
+		return
+	}
+
+	lr.done = make(chan struct{})
+	go lr.poll(lr.done)
+}
+
+// unwatch stops watching the files and disconnects the browsers.
+func (lr *liveReload) unwatch() {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	if lr.done == nil {
+		return
+	}
+
+	close(lr.done)
+	lr.done = nil
+	for c := range lr.clients {
+		close(c)
+		delete(lr.clients, c)
+	}
+}
+
+func (lr *liveReload) poll(done chan struct{}) {
+	files := snapshot(lr.root)
+	t := time.NewTicker(liveReloadInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+
+		current := snapshot(lr.root)
+		if changed := changedFiles(files, current); len(changed) > 0 {
+			lr.notify(reloadKind(changed))
+		}
+		files = current
+	}
+}
+
+func (lr *liveReload) notify(kind string) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	for c := range lr.clients {
+		select {
+		case c <- kind:
+		default:
+		}
+	}
+}
+
+// ServeHTTP serves the reload script and the stream of changes.
+func (lr *liveReload) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == liveReloadPath+".js" {
+		w.Header().Set("Content-Type", "application/javascript")
+		fmt.Fprint(w, liveReloadScript)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	c := make(chan string, 1)
+	lr.mu.Lock()
+	watching := lr.done != nil
+	if watching {
+		lr.clients[c] = true
+	}
+	lr.mu.Unlock()
+
+	if !watching {
+		http.Error(w, "Not watching", http.StatusServiceUnavailable)
+		return
+	}
+
+	defer func() {
+		lr.mu.Lock()
+		delete(lr.clients, c)
+		lr.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case kind, ok := <-c:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", kind, kind)
+			flusher.Flush()
+		}
+	}
+}
+
+// injectLiveReload adds the reload script to the end of the body of html.
+func injectLiveReload(html []byte) []byte {
+	i := bytes.LastIndex(bytes.ToLower(html), []byte("</body>"))
+	if i < 0 {
+		return append(html, liveReloadTag...)
+	}
+
+	b := make([]byte, 0, len(html)+len(liveReloadTag))
+	b = append(b, html[:i]...)
+	b = append(b, liveReloadTag...)
+	return append(b, html[i:]...)
+}
+
+// fileStamp identifies a version of a file.
+type fileStamp struct {
+	size    int64
+	modTime int64
+}
+
+// snapshot stamps the files under root, skipping hidden directories and
+// node_modules.
+func snapshot(root string) map[string]fileStamp {
+	files := make(map[string]fileStamp)
+	filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if info.IsDir() {
+			name := info.Name()
+			if p != root && (strings.HasPrefix(name, ".") || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		files[p] = fileStamp{info.Size(), info.ModTime().UnixNano()}
+		return nil
+	})
+	return files
+}
+
+// changedFiles returns the files added, removed or modified from old to current.
+func changedFiles(old, current map[string]fileStamp) []string {
+	changed := []string{}
+	for p, s := range current {
+		if o, ok := old[p]; !ok || o != s {
+			changed = append(changed, p)
+		}
+	}
+	for p := range old {
+		if _, ok := current[p]; !ok {
+			changed = append(changed, p)
+		}
+	}
+	return changed
+}
+
+// reloadKind returns css if only stylesheets have changed, which can be
+// swapped without reloading the page, or reload otherwise.
+func reloadKind(changed []string) string {
+	for _, p := range changed {
+		if filepath.Ext(p) != ".css" {
+			return "reload"
+		}
+	}
+	return "css"
+}
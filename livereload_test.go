@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInjectLiveReload(t *testing.T) {
+	tests := []struct {
+		html     string
+		expected string
+	}{
+		{"<html><body>hi</body></html>", "<html><body>hi" + string(liveReloadTag) + "</body></html>"},
+		{"<HTML><BODY>hi</BODY></HTML>", "<HTML><BODY>hi" + string(liveReloadTag) + "</BODY></HTML>"},
+		{"<p>hi</p>", "<p>hi</p>" + string(liveReloadTag)},
+	}
+
+	for _, tt := range tests {
+		got := string(injectLiveReload([]byte(tt.html)))
+		if got != tt.expected {
+			t.Errorf("%s: got %s; expected %s", tt.html, got, tt.expected)
+		}
+	}
+}
+
+func TestReloadKind(t *testing.T) {
+	old := map[string]fileStamp{"a.css": {1, 1}, "b.css": {1, 1}, "index.html": {1, 1}}
+	tests := []struct {
+		current map[string]fileStamp
+		kind    string
+	}{
+		{map[string]fileStamp{"a.css": {1, 2}, "b.css": {1, 1}, "index.html": {1, 1}}, "css"},
+		{map[string]fileStamp{"a.css": {1, 1}, "index.html": {1, 1}}, "css"},
+		{map[string]fileStamp{"a.css": {1, 2}, "b.css": {1, 1}, "index.html": {2, 1}}, "reload"},
+		{map[string]fileStamp{"a.css": {1, 1}, "b.css": {1, 1}, "index.html": {1, 1}, "app.js": {1, 1}}, "reload"},
+	}
+
+	for i, tt := range tests {
+		if kind := reloadKind(changedFiles(old, tt.current)); kind != tt.kind {
+			t.Errorf("%d: got %s; expected %s", i, kind, tt.kind)
+		}
+	}
+
+	if changed := changedFiles(old, old); len(changed) != 0 {
+		t.Errorf("Changed: got %v; expected nothing", changed)
+	}
+}
+
+func TestLiveReload(t *testing.T) {
+	defer func(d time.Duration) { liveReloadInterval = d }(liveReloadInterval)
+	liveReloadInterval = 20 * time.Millisecond
+
+	dir := newTestDir(t, map[string]string{
+		".bam.toml":  "[static]\nlive_reload = true\n",
+		"index.html": "<html><body>hi</body></html>",
+		"app.css":    "body {}",
+	})
+	defer os.RemoveAll(dir)
+
+	a, err := NewWebServerApp(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Stop()
+
+	base := fmt.Sprintf("http://localhost:%d", a.Port())
+	res, err := http.Get(base + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if !strings.Contains(string(body), string(liveReloadTag)) {
+		t.Errorf("Reload script not injected: %s", body)
+	}
+
+	res, err = http.Get(base + liveReloadPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	<-time.After(50 * time.Millisecond) // let the watcher take its first snapshot
+
+	err = ioutil.WriteFile(path.Join(dir, "app.css"), []byte("body { color: red; }"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := make(chan string, 10)
+	go func() {
+		s := bufio.NewScanner(res.Body)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+		close(lines)
+	}()
+
+	select {
+	case line := <-lines:
+		if line != "event: css" {
+			t.Errorf("Event: got %q; expected css", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("Expected a css event")
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the request
+// latency histogram.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// lifecycleCounters names the counter incremented by each event.
+var lifecycleCounters = map[EventType]string{
+	EventStarting: "bam_app_starts_total",
+	EventStopped:  "bam_app_stops_total",
+	EventCrashed:  "bam_app_crashes_total",
+}
+
+// Metrics collects the requests proxied to each application and their
+// lifecycle events, exposing them in the Prometheus text format.
+// A nil Metrics collects nothing.
+type Metrics struct {
+	mu             sync.Mutex
+	requests       map[requestKey]int64
+	durations      map[string]*histogram
+	upstreamErrors map[string]int64
+	lifecycle      map[string]map[string]int64
+	apps           func() []*ShareableApp
+	usage          *usageSampler
+}
+
+type requestKey struct {
+	app  string
+	code int
+}
+
+// histogram counts observations into cumulative buckets.
+type histogram struct {
+	counts []int64
+	count  int64
+	sum    float64
+}
+
+func NewMetrics(apps func() []*ShareableApp, usage *usageSampler) *Metrics {
+	m := &Metrics{
+		requests:       make(map[requestKey]int64),
+		durations:      make(map[string]*histogram),
+		upstreamErrors: make(map[string]int64),
+		lifecycle:      make(map[string]map[string]int64),
+		apps:           apps,
+		usage:          usage,
+	}
+	for _, name := range lifecycleCounters {
+		m.lifecycle[name] = make(map[string]int64)
+	}
+	return m
+}
+
+// Listen counts the lifecycle events published on bus.
+func (m *Metrics) Listen(bus *EventBus) {
+	for e := range bus.Subscribe() {
+		m.event(e)
+	}
+}
+
+func (m *Metrics) event(e Event) {
+	name, ok := lifecycleCounters[e.Type]
+	if m == nil || !ok {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lifecycle[name][e.App]++
+}
+
+// observe records a request proxied to app.
+func (m *Metrics) observe(app string, code int, d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[requestKey{app, code}]++
+
+	h, ok := m.durations[app]
+	if !ok {
+		h = &histogram{counts: make([]int64, len(durationBuckets))}
+		m.durations[app] = h
+	}
+
+	seconds := d.Seconds()
+	for i, le := range durationBuckets {
+		if seconds <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// upstreamError records a request to app which couldn't be proxied.
+func (m *Metrics) upstreamError(app string) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.upstreamErrors[app]++
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+func (m *Metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	metricHeader(w, "bam_requests_total", "counter", "Requests proxied to each application, by status code.")
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].app != keys[j].app {
+			return keys[i].app < keys[j].app
+		}
+		return keys[i].code < keys[j].code
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "bam_requests_total{app=\"%s\",code=\"%d\"} %d\n", label(k.app), k.code, m.requests[k])
+	}
+
+	metricHeader(w, "bam_request_duration_seconds", "histogram", "Time taken to proxy requests to each application.")
+	apps := []string{}
+	for app := range m.durations {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+	for _, app := range apps {
+		h := m.durations[app]
+		for i, le := range durationBuckets {
+			fmt.Fprintf(w, "bam_request_duration_seconds_bucket{app=\"%s\",le=\"%g\"} %d\n", label(app), le, h.counts[i])
+		}
+		fmt.Fprintf(w, "bam_request_duration_seconds_bucket{app=\"%s\",le=\"+Inf\"} %d\n", label(app), h.count)
+		fmt.Fprintf(w, "bam_request_duration_seconds_sum{app=\"%s\"} %g\n", label(app), h.sum)
+		fmt.Fprintf(w, "bam_request_duration_seconds_count{app=\"%s\"} %d\n", label(app), h.count)
+	}
+
+	metricHeader(w, "bam_upstream_errors_total", "counter", "Requests which couldn't be proxied to each application.")
+	writeCounters(w, "bam_upstream_errors_total", m.upstreamErrors)
+
+	metricHeader(w, "bam_app_starts_total", "counter", "Times each application was started.")
+	writeCounters(w, "bam_app_starts_total", m.lifecycle["bam_app_starts_total"])
+	metricHeader(w, "bam_app_stops_total", "counter", "Times each application was stopped.")
+	writeCounters(w, "bam_app_stops_total", m.lifecycle["bam_app_stops_total"])
+	metricHeader(w, "bam_app_crashes_total", "counter", "Times each application crashed.")
+	writeCounters(w, "bam_app_crashes_total", m.lifecycle["bam_app_crashes_total"])
+
+	var registered []*ShareableApp
+	if m.apps != nil {
+		registered = m.apps()
+	}
+
+	metricHeader(w, "bam_app_up", "gauge", "Whether each application is running.")
+	for _, a := range registered {
+		fmt.Fprintf(w, "bam_app_up{app=\"%s\"} %d\n", label(a.Name()), boolValue(a.Running()))
+	}
+
+	metricHeader(w, "bam_app_down", "gauge", "Whether each application is failing its health probes.")
+	for _, a := range registered {
+		fmt.Fprintf(w, "bam_app_down{app=\"%s\"} %d\n", label(a.Name()), boolValue(a.State() == Down))
+	}
+
+	usage := []*Usage{}
+	for _, a := range registered {
+		if u := m.usage.Usage(a.Name()); u != nil {
+			usage = append(usage, u)
+		}
+	}
+
+	metricHeader(w, "bam_app_cpu_percent", "gauge", "CPU used by the processes of each application, where 100 is a whole core.")
+	for _, u := range usage {
+		fmt.Fprintf(w, "bam_app_cpu_percent{app=\"%s\"} %g\n", label(u.App), u.CPU)
+	}
+
+	metricHeader(w, "bam_app_resident_memory_bytes", "gauge", "Resident memory of the processes of each application.")
+	for _, u := range usage {
+		fmt.Fprintf(w, "bam_app_resident_memory_bytes{app=\"%s\"} %d\n", label(u.App), u.RSS)
+	}
+
+	metricHeader(w, "bam_app_open_fds", "gauge", "Open file descriptors of the processes of each application.")
+	for _, u := range usage {
+		fmt.Fprintf(w, "bam_app_open_fds{app=\"%s\"} %d\n", label(u.App), u.OpenFiles)
+	}
+
+	writeProcessMetrics(w)
+}
+
+// writeProcessMetrics writes the resource usage of BAM! itself.
+func writeProcessMetrics(w io.Writer) {
+	if s, err := readProcStats(os.Getpid()); err == nil {
+		metricHeader(w, "process_cpu_seconds_total", "counter", "Total user and system CPU time spent in seconds.")
+		fmt.Fprintf(w, "process_cpu_seconds_total %g\n", s.CPU.Seconds())
+		metricHeader(w, "process_resident_memory_bytes", "gauge", "Resident memory size in bytes.")
+		fmt.Fprintf(w, "process_resident_memory_bytes %d\n", s.RSS)
+		metricHeader(w, "process_open_fds", "gauge", "Number of open file descriptors.")
+		fmt.Fprintf(w, "process_open_fds %d\n", s.OpenFiles)
+		if !s.StartTime.IsZero() {
+			metricHeader(w, "process_start_time_seconds", "gauge", "Start time of the process since unix epoch in seconds.")
+			fmt.Fprintf(w, "process_start_time_seconds %d\n", s.StartTime.Unix())
+		}
+	}
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	metricHeader(w, "go_goroutines", "gauge", "Number of goroutines that currently exist.")
+	fmt.Fprintf(w, "go_goroutines %d\n", runtime.NumGoroutine())
+	metricHeader(w, "go_memstats_alloc_bytes", "gauge", "Number of bytes allocated and still in use.")
+	fmt.Fprintf(w, "go_memstats_alloc_bytes %d\n", ms.Alloc)
+	metricHeader(w, "go_memstats_sys_bytes", "gauge", "Number of bytes obtained from system.")
+	fmt.Fprintf(w, "go_memstats_sys_bytes %d\n", ms.Sys)
+}
+
+func metricHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeCounters(w io.Writer, name string, counters map[string]int64) {
+	apps := []string{}
+	for app := range counters {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+	for _, app := range apps {
+		fmt.Fprintf(w, "%s{app=\"%s\"} %d\n", name, label(app), counters[app])
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// label escapes a label value of the Prometheus text format.
+func label(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func boolValue(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	m := NewMetrics(nil, nil)
+	p := NewProxy(newAppCenter([]App{
+		newApp("myapp", getServerPort(t, s.URL)),
+		newApp("broken", closedPort),
+	}), "local")
+	p.Measure(m)
+
+	for _, target := range []string{"http://myapp.local/", "http://myapp.local/", "http://myapp.local/missing", "http://broken.local/"} {
+		p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+
+	m.event(Event{Type: EventStarting, App: "myapp"})
+	m.event(Event{Type: EventCrashed, App: "myapp"})
+	m.event(Event{Type: EventLog, App: "myapp"})
+
+	var out bytes.Buffer
+	m.write(&out)
+	metrics := out.String()
+
+	expected := []string{
+		`bam_requests_total{app="myapp",code="200"} 2`,
+		`bam_requests_total{app="myapp",code="404"} 1`,
+		`bam_requests_total{app="broken",code="502"} 1`,
+		`bam_request_duration_seconds_bucket{app="myapp",le="+Inf"} 3`,
+		`bam_request_duration_seconds_count{app="myapp"} 3`,
+		`bam_upstream_errors_total{app="broken"} 1`,
+		`bam_app_starts_total{app="myapp"} 1`,
+		`bam_app_crashes_total{app="myapp"} 1`,
+		"# TYPE bam_request_duration_seconds histogram",
+		"# TYPE go_goroutines gauge",
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(metrics, line+"\n") {
+			t.Errorf("Metrics: %s not found", line)
+		}
+	}
+
+	if strings.Contains(metrics, "bam_app_stops_total{") || strings.Contains(metrics, `bam_upstream_errors_total{app="myapp"}`) {
+		t.Errorf("Metrics: unexpected samples in\n%s", metrics)
+	}
+}
+
+func TestMetricsHistogram(t *testing.T) {
+	m := NewMetrics(nil, nil)
+	m.observe("myapp", 200, 20*time.Millisecond)
+	m.observe("myapp", 200, 3*time.Second)
+
+	var out bytes.Buffer
+	m.write(&out)
+
+	tests := []struct {
+		le    string
+		count int
+	}{
+		{"0.01", 0},
+		{"0.025", 1},
+		{"2.5", 1},
+		{"5", 2},
+		{"+Inf", 2},
+	}
+
+	for _, tt := range tests {
+		line := fmt.Sprintf("bam_request_duration_seconds_bucket{app=\"myapp\",le=\"%s\"} %d\n", tt.le, tt.count)
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Bucket %s: expected %d", tt.le, tt.count)
+		}
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	c := &Config{AppsDir: "./examples/", Tld: "app"}
+	cc := NewCommandCenter("bam", c)
+
+	w := httptest.NewRecorder()
+	cc.handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("Metrics: got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	for _, line := range []string{`bam_app_up{app="static"} 0`, `bam_app_down{app="static"} 0`} {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Errorf("Metrics: %s not found", line)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// NotifyConfig selects the application events reported to the user and how.
+type NotifyConfig struct {
+	Desktop bool     `toml:"desktop"`
+	Command string   `toml:"command"`
+	Events  []string `toml:"events"`
+}
+
+// Enabled reports whether any kind of notification is configured.
+func (c NotifyConfig) Enabled() bool {
+	return c.Desktop || c.Command != ""
+}
+
+// Notifier reports application events through desktop notifications
+// and/or a user-configured command hook.
+type Notifier struct {
+	desktop bool
+	command string
+	events  map[EventType]bool
+	run     func(*exec.Cmd) error
+}
+
+func NewNotifier(c NotifyConfig) *Notifier {
+	n := &Notifier{
+		desktop: c.Desktop,
+		command: c.Command,
+		events:  make(map[EventType]bool),
+		run:     func(cmd *exec.Cmd) error { return cmd.Run() },
+	}
+	for _, e := range c.Events {
+		n.events[EventType(strings.ToLower(e))] = true
+	}
+	return n
+}
+
+// Listen notifies every selected event published on bus.
+func (n *Notifier) Listen(bus *EventBus) {
+	for e := range bus.Subscribe() {
+		if n.events[e.Type] {
+			n.Notify(e)
+		}
+	}
+}
+
+func (n *Notifier) Notify(e Event) {
+	if n.desktop {
+		err := n.run(n.desktopCommand(e))
+		if err != nil {
+			log.Printf("ERROR: desktop notification for %s: %v\n", e.App, err)
+		}
+	}
+
+	if n.command != "" {
+		err := n.run(n.hookCommand(e))
+		if err != nil {
+			log.Printf("ERROR: notify command for %s: %v\n", e.App, err)
+		}
+	}
+}
+
+// desktopCommand builds a freedesktop notification for e, using notify-send
+// when available and falling back to calling D-Bus through gdbus.
+func (n *Notifier) desktopCommand(e Event) *exec.Cmd {
+	summary := fmt.Sprintf("%s %s", e.App, e.Type)
+	body := e.Data
+	urgency := "normal"
+	if e.Type == EventCrashed {
+		urgency = "critical"
+	}
+
+	if _, err := exec.LookPath("notify-send"); err == nil {
+		return exec.Command("notify-send", "-a", programName, "-u", urgency, summary, body)
+	}
+
+	return exec.Command("gdbus", "call", "--session",
+		"--dest", "org.freedesktop.Notifications",
+		"--object-path", "/org/freedesktop/Notifications",
+		"--method", "org.freedesktop.Notifications.Notify",
+		programName, "0", "", summary, body, "[]", "{}", "5000")
+}
+
+// hookCommand builds the user-configured command for e. The event is
+// described by the BAM_APP, BAM_EVENT, BAM_MESSAGE and, for crashed
+// processes, BAM_EXIT_CODE environment variables.
+func (n *Notifier) hookCommand(e Event) *exec.Cmd {
+	cmd := exec.Command("/bin/sh", "-c", n.command)
+	cmd.Env = append(os.Environ(),
+		"BAM_APP="+e.App,
+		"BAM_EVENT="+string(e.Type),
+		"BAM_MESSAGE="+e.Data)
+	if e.ExitCode != nil {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("BAM_EXIT_CODE=%d", *e.ExitCode))
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd
+}
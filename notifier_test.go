@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestNotifier(t *testing.T) {
+	cmds := []*exec.Cmd{}
+	n := NewNotifier(NotifyConfig{Desktop: true, Command: "true", Events: []string{"crashed"}})
+	n.run = func(cmd *exec.Cmd) error {
+		cmds = append(cmds, cmd)
+		return nil
+	}
+
+	code := 2
+	n.Notify(Event{Type: EventCrashed, App: "ping", Data: "web exited with code 2", ExitCode: &code})
+
+	if len(cmds) != 2 {
+		t.Fatalf("Commands run: got %d; expected 2", len(cmds))
+	}
+
+	desktop := strings.Join(cmds[0].Args, " ")
+	if !strings.Contains(desktop, "ping crashed") || !strings.Contains(desktop, "web exited with code 2") {
+		t.Errorf("Unexpected desktop notification: %s", desktop)
+	}
+
+	env := strings.Join(cmds[1].Env, "\n")
+	for _, v := range []string{"BAM_APP=ping", "BAM_EVENT=crashed", "BAM_EXIT_CODE=2"} {
+		if !strings.Contains(env, v) {
+			t.Errorf("Hook environment doesn't contain %s", v)
+		}
+	}
+}
+
+func TestNotifierEvents(t *testing.T) {
+	n := NewNotifier(NotifyConfig{Command: "true", Events: []string{"Crashed"}})
+	if !n.events[EventCrashed] {
+		t.Error("Event names should be case insensitive")
+	}
+
+	if n.events[EventReady] {
+		t.Error("Only selected events should be notified")
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+)
+
+// portsFile is the file, inside bam's data directory, where the last
+// port of each application is kept.
+const portsFile = "ports.json"
+
+// maxPortAttempts bounds the search for an ephemeral port not reserved yet.
+const maxPortAttempts = 100
+
+// PortAllocator hands out ports to applications. Each application gets
+// back its fixed port or, when free, the port it used last time. Ports
+// are reserved until released, so that the same port is never handed
+// out twice while a child process is still about to bind it. Reservations
+// only bind bam, though: another program may still take a port before
+// the child binds it, failing the start of the application.
+//
+// A nil PortAllocator hands out any free port and remembers nothing.
+type PortAllocator struct {
+	mu       sync.Mutex
+	min, max int
+	file     string
+	last     map[string]int
+	reserved map[int]string
+}
+
+// NewPortAllocator creates a PortAllocator handing out ports between min
+// and max, or any free port if max is zero. If dir isn't empty, the
+// last port of each application is kept there across restarts.
+func NewPortAllocator(min, max int, dir string) *PortAllocator {
+	pa := &PortAllocator{
+		min:      min,
+		max:      max,
+		last:     make(map[string]int),
+		reserved: make(map[int]string),
+	}
+
+	if dir != "" {
+		pa.file = path.Join(dir, portsFile)
+		pa.load()
+	}
+	return pa
+}
+
+// newPortAllocator creates the PortAllocator described by c.
+func newPortAllocator(c *Config) *PortAllocator {
+	min, max := 0, 0
+	if len(c.PortRange) == 2 && c.PortRange[0] > 0 && c.PortRange[0] <= c.PortRange[1] {
+		min, max = c.PortRange[0], c.PortRange[1]
+	} else if len(c.PortRange) > 0 {
+		log.Printf("WARN ignoring invalid port_range %v\n", c.PortRange)
+	}
+	return NewPortAllocator(min, max, c.DataDir)
+}
+
+// portAware is implemented by applications getting their ports from a
+// PortAllocator.
+type portAware interface {
+	setPortAllocator(*PortAllocator)
+}
+
+// Allocate reserves a port for the named process of app. A fixed port
+// greater than zero must be free, otherwise an error is returned.
+func (pa *PortAllocator) Allocate(app, process string, fixed int) (int, error) {
+	if pa == nil {
+		if fixed > 0 {
+			return fixed, nil
+		}
+		return FreePort()
+	}
+
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	key := portKey(app, process)
+	port, err := pa.find(app, key, fixed)
+	if err != nil {
+		return 0, err
+	}
+
+	pa.reserved[port] = app
+	if pa.last[key] != port {
+		pa.last[key] = port
+		pa.save()
+	}
+	return port, nil
+}
+
+// Prefer makes port the one handed out to the named process of app, as
+// long as it's free.
+func (pa *PortAllocator) Prefer(app, process string, port int) {
+	if pa == nil {
+		return
+	}
+
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	key := portKey(app, process)
+	if pa.last[key] != port {
+		pa.last[key] = port
+		pa.save()
+	}
+}
+
+// Release frees all ports reserved by app.
+func (pa *PortAllocator) Release(app string) {
+	if pa == nil {
+		return
+	}
+
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	for port, owner := range pa.reserved {
+		if owner == app {
+			delete(pa.reserved, port)
+		}
+	}
+}
+
+// ReleasePort frees a single port.
+func (pa *PortAllocator) ReleasePort(port int) {
+	if pa == nil {
+		return
+	}
+
+	pa.mu.Lock()
+	delete(pa.reserved, port)
+	pa.mu.Unlock()
+}
+
+func (pa *PortAllocator) find(app, key string, fixed int) (int, error) {
+	if fixed > 0 {
+		if owner, ok := pa.reserved[fixed]; ok && owner != app {
+			return 0, fmt.Errorf("Port %d is already assigned to %s", fixed, owner)
+		}
+
+		if !portFree(fixed) {
+			return 0, fmt.Errorf("Port %d is in use", fixed)
+		}
+		return fixed, nil
+	}
+
+	if last, ok := pa.last[key]; ok && pa.available(last) {
+		return last, nil
+	}
+
+	if pa.max > 0 {
+		for port := pa.min; port <= pa.max; port++ {
+			if pa.available(port) {
+				return port, nil
+			}
+		}
+		return 0, fmt.Errorf("No free port between %d and %d", pa.min, pa.max)
+	}
+
+	for i := 0; i < maxPortAttempts; i++ {
+		port, err := FreePort()
+		if err != nil {
+			return 0, err
+		}
+
+		if _, ok := pa.reserved[port]; !ok {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("No free port found")
+}
+
+// available reports whether port is in range, not reserved and free.
+func (pa *PortAllocator) available(port int) bool {
+	if pa.max > 0 && (port < pa.min || port > pa.max) {
+		return false
+	}
+
+	if _, ok := pa.reserved[port]; ok {
+		return false
+	}
+	return portFree(port)
+}
+
+func (pa *PortAllocator) load() {
+	b, err := ioutil.ReadFile(pa.file)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(b, &pa.last)
+	if err != nil {
+		log.Printf("WARN ignoring invalid ports file %s: %v\n", pa.file, err)
+	}
+}
+
+func (pa *PortAllocator) save() {
+	if pa.file == "" {
+		return
+	}
+
+	b, err := json.MarshalIndent(pa.last, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(path.Dir(pa.file), 0755)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(pa.file, b, 0644)
+	}
+	if err != nil {
+		log.Printf("ERROR: unable to save ports file %s: %v\n", pa.file, err)
+	}
+}
+
+func portKey(app, process string) string {
+	if process == "" {
+		return app
+	}
+	return fmt.Sprintf("%s.%s", app, process)
+}
+
+// portFree reports whether port can be bound on all interfaces, so that
+// a port used by another program on any address isn't taken as free.
+// Hosts without IPv6 are only probed on IPv4.
+func portFree(port int) bool {
+	l, err := net.Listen("tcp4", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+	l.Close()
+
+	l, err = net.Listen("tcp6", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return !errors.Is(err, syscall.EADDRINUSE)
+	}
+	l.Close()
+	return true
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestPortAllocatorSticky(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pa := NewPortAllocator(0, 0, dir)
+	port, err := pa.Allocate("myapp", "web", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pa.Release("myapp")
+
+	again, err := NewPortAllocator(0, 0, dir).Allocate("myapp", "web", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again != port {
+		t.Errorf("Port: got %d; expected last port %d", again, port)
+	}
+}
+
+func TestPortAllocatorReserved(t *testing.T) {
+	pa := NewPortAllocator(0, 0, "")
+	seen := make(map[int]bool)
+	for _, name := range []string{"web", "worker", "clock"} {
+		port, err := pa.Allocate("myapp", name, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if seen[port] {
+			t.Errorf("Port %d handed out twice", port)
+		}
+		seen[port] = true
+	}
+}
+
+func TestPortFree(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1:0", "0.0.0.0:0"} {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		port, _ := AddrPort(l.Addr().String())
+		if portFree(port) {
+			t.Errorf("Port %d bound on %s should not be free", port, addr)
+		}
+		l.Close()
+
+		if !portFree(port) {
+			t.Errorf("Port %d should be free once closed", port)
+		}
+	}
+}
+
+func TestPortAllocatorRange(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	busy, _ := AddrPort(l.Addr().String())
+	pa := NewPortAllocator(busy, busy+1, "")
+
+	port, err := pa.Allocate("myapp", "web", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if port != busy+1 {
+		t.Errorf("Port: got %d; expected %d", port, busy+1)
+	}
+
+	if _, err := pa.Allocate("other", "web", 0); err == nil {
+		t.Error("Range exhausted, allocation should fail")
+	}
+
+	if _, err := pa.Allocate("fixed", "web", busy); err == nil {
+		t.Error("Fixed port in use should not be allocated")
+	}
+}
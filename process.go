@@ -0,0 +1,281 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// process is an instance of a Procfile entry started through the shell
+// in its own process group, so that stopping it also stops its children.
+// The name of the instance, like web.1, is built from the name of the
+// Procfile entry, its kind.
+//
+// bam used procker's processes before, but they only tell whether they
+// are running: crash reports need to wait for a process to exit, without
+// polling, and to know which one exited, with which code or signal.
+type process struct {
+	name    string
+	kind    string
+	command string
+	setup   string // shell commands run before command
+	dir     string
+	env     []string
+	stdout  io.Writer
+	stderr  io.Writer
+
+	mu   sync.Mutex
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+func (p *process) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.done != nil {
+		return errAlreadyStarted
+	}
+
+	cmd := exec.Command("/bin/sh", "-c", p.setup+p.command)
+	cmd.Dir = p.dir
+	cmd.Env = append(os.Environ(), p.env...)
+	cmd.Stdout = p.stdout
+	cmd.Stderr = p.stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	p.cmd = cmd
+	p.done = make(chan struct{})
+	go func(done chan struct{}) {
+		cmd.Wait()
+		close(done)
+	}(p.done)
+	return nil
+}
+
+// Stop sends SIGTERM to the process group, killing it if it is still
+// running after timeout.
+func (p *process) Stop(timeout time.Duration) error {
+	p.mu.Lock()
+	cmd, done := p.cmd, p.done
+	p.mu.Unlock()
+
+	if done == nil {
+		return errNotStarted
+	}
+
+	pgid := -cmd.Process.Pid
+	syscall.Kill(pgid, syscall.SIGTERM)
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		syscall.Kill(pgid, syscall.SIGKILL)
+		<-done
+		return errors.New("Killed after timeout")
+	}
+}
+
+func (p *process) Running() bool {
+	p.mu.Lock()
+	done := p.done
+	p.mu.Unlock()
+
+	if done == nil {
+		return false
+	}
+
+	select {
+	case <-done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Done returns a channel closed when the process exits.
+func (p *process) Done() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.done
+}
+
+// Pid returns the process id of the shell running the command.
+func (p *process) Pid() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd == nil || p.cmd.Process == nil {
+		return 0
+	}
+	return p.cmd.Process.Pid
+}
+
+// ExitCode returns the exit code of an exited process, or -1 if it is
+// still running or was terminated by a signal.
+func (p *process) ExitCode() int {
+	if p.Running() {
+		return -1
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd == nil || p.cmd.ProcessState == nil {
+		return -1
+	}
+	return p.cmd.ProcessState.ExitCode()
+}
+
+// Signal returns the signal which terminated an exited process, either
+// directly or through the shell running its command.
+func (p *process) Signal() (syscall.Signal, bool) {
+	if p.Running() {
+		return 0, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd == nil || p.cmd.ProcessState == nil {
+		return 0, false
+	}
+
+	if ws, ok := p.cmd.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return ws.Signal(), true
+	}
+
+	if code := p.cmd.ProcessState.ExitCode(); code > 128 {
+		return syscall.Signal(code - 128), true
+	}
+	return 0, false
+}
+
+// processGroup manages the instances of the processes of a Procfile as
+// a whole. Instances may be added and removed while the group is running.
+type processGroup struct {
+	mu        sync.RWMutex
+	processes []*process
+}
+
+func newProcessGroup(processes ...*process) *processGroup {
+	return &processGroup{processes: processes}
+}
+
+func (g *processGroup) Start() error {
+	processes := g.list()
+	for i, p := range processes {
+		err := p.Start()
+		if err != nil {
+			newProcessGroup(processes[:i]...).Stop(0)
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *processGroup) Stop(timeout time.Duration) error {
+	var wg sync.WaitGroup
+	processes := g.list()
+	errs := make([]error, len(processes))
+	for i, p := range processes {
+		if !p.Running() {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, p *process) {
+			defer wg.Done()
+			errs[i] = p.Stop(timeout)
+		}(i, p)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Running reports whether every process of the group is running.
+func (g *processGroup) Running() bool {
+	processes := g.list()
+	for _, p := range processes {
+		if !p.Running() {
+			return false
+		}
+	}
+	return len(processes) > 0
+}
+
+// list returns the processes of the group sorted by name.
+func (g *processGroup) list() []*process {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	processes := make([]*process, len(g.processes))
+	copy(processes, g.processes)
+	sort.Sort(byProcessName(processes))
+	return processes
+}
+
+// running returns the running instances of the given kind, sorted by name.
+func (g *processGroup) running(kind string) []*process {
+	processes := []*process{}
+	for _, p := range g.list() {
+		if p.kind == kind && p.Running() {
+			processes = append(processes, p)
+		}
+	}
+	return processes
+}
+
+func (g *processGroup) add(p *process) {
+	g.mu.Lock()
+	g.processes = append(g.processes, p)
+	g.mu.Unlock()
+}
+
+// remove takes the named process out of the group and returns it.
+func (g *processGroup) remove(name string) *process {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, p := range g.processes {
+		if p.name == name {
+			g.processes = append(g.processes[:i], g.processes[i+1:]...)
+			return p
+		}
+	}
+	return nil
+}
+
+func (g *processGroup) contains(p *process) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	for _, q := range g.processes {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+// byProcessName sorts processes by kind and instance number.
+type byProcessName []*process
+
+func (s byProcessName) Len() int      { return len(s) }
+func (s byProcessName) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byProcessName) Less(i, j int) bool {
+	if s[i].kind != s[j].kind {
+		return s[i].kind < s[j].kind
+	}
+	return len(s[i].name) < len(s[j].name) || (len(s[i].name) == len(s[j].name) && s[i].name < s[j].name)
+}
@@ -0,0 +1,69 @@
+package main
+
+import "time"
+
+// procStats is the resource usage of a process.
+type procStats struct {
+	PPid      int
+	Pgrp      int
+	CPU       time.Duration // user and system time
+	RSS       int64         // resident memory, in bytes
+	OpenFiles int
+	StartTime time.Time
+}
+
+// readProcTable returns the stats of every process, read from their stat
+// alone, so that it can be shared by the processTree calls of a sample.
+func readProcTable() map[int]procStats {
+	all := make(map[int]procStats)
+	pids, err := listPids()
+	if err != nil {
+		return all
+	}
+
+	for _, pid := range pids {
+		if s, err := readProcStat(pid); err == nil {
+			all[pid] = s
+		}
+	}
+	return all
+}
+
+// processTree returns the stats of the processes of all in the process
+// groups led by roots, and of all of their descendants, even if they left
+// the group. Open files are only counted for the processes in the tree.
+func processTree(roots []int, all map[int]procStats) map[int]procStats {
+	tree := make(map[int]procStats)
+	if len(roots) == 0 {
+		return tree
+	}
+
+	leaders := make(map[int]bool)
+	for _, pid := range roots {
+		leaders[pid] = true
+	}
+
+	for pid, s := range all {
+		if leaders[pid] || leaders[s.Pgrp] {
+			tree[pid] = s
+		}
+	}
+
+	for found := true; found; {
+		found = false
+		for pid, s := range all {
+			if _, ok := tree[pid]; !ok {
+				if _, ok := tree[s.PPid]; ok {
+					tree[pid] = s
+					found = true
+				}
+			}
+		}
+	}
+
+	for pid, s := range tree {
+		s.OpenFiles = countOpenFiles(pid)
+		tree[pid] = s
+	}
+	return tree
+}
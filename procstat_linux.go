@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clockTicks is the number of clock ticks per second used by /proc, which
+// is 100 on virtually every Linux system.
+const clockTicks = 100
+
+// readProcStats reads the resource usage of the process pid from /proc.
+func readProcStats(pid int) (procStats, error) {
+	s, err := readProcStat(pid)
+	if err != nil {
+		return s, err
+	}
+	s.OpenFiles = countOpenFiles(pid)
+	return s, nil
+}
+
+// readProcStat reads the resource usage of the process pid from
+// /proc/<pid>/stat alone, leaving the open files uncounted.
+func readProcStat(pid int) (procStats, error) {
+	var s procStats
+
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return s, err
+	}
+
+	// The command name may contain spaces, so fields are counted from
+	// its closing parenthesis, starting at the third one: state.
+	stat := string(b)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	if len(fields) < 22 {
+		return s, fmt.Errorf("Unexpected format of /proc/%d/stat", pid)
+	}
+
+	s.PPid, _ = strconv.Atoi(fields[1])
+	s.Pgrp, _ = strconv.Atoi(fields[2])
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	start, _ := strconv.ParseInt(fields[19], 10, 64)
+	rss, _ := strconv.ParseInt(fields[21], 10, 64)
+
+	s.CPU = time.Duration(utime+stime) * time.Second / clockTicks
+	s.RSS = rss * int64(os.Getpagesize())
+
+	if boot, err := bootTime(); err == nil {
+		s.StartTime = boot.Add(time.Duration(start) * time.Second / clockTicks)
+	}
+
+	return s, nil
+}
+
+// countOpenFiles returns the number of files opened by the process pid.
+func countOpenFiles(pid int) int {
+	fds, err := ioutil.ReadDir(fmt.Sprintf("/proc/%d/fd", pid))
+	if err != nil {
+		return 0
+	}
+	return len(fds)
+}
+
+// listPids returns the ids of all processes.
+func listPids() ([]int, error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	pids := []int{}
+	for _, e := range entries {
+		if pid, err := strconv.Atoi(e.Name()); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+var (
+	bootOnce sync.Once
+	boot     time.Time
+	bootErr  error
+)
+
+// bootTime returns when the system booted, read once from /proc/stat.
+func bootTime() (time.Time, error) {
+	bootOnce.Do(func() {
+		boot, bootErr = readBootTime()
+	})
+	return boot, bootErr
+}
+
+func readBootTime() (time.Time, error) {
+	b, err := ioutil.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "btime ") {
+			sec, err := strconv.ParseInt(strings.TrimSpace(line[6:]), 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(sec, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Boot time not found in /proc/stat")
+}
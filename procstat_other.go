@@ -0,0 +1,24 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// readProcStats is only supported on Linux, where /proc is available.
+func readProcStats(pid int) (procStats, error) {
+	return procStats{}, errProcStats
+}
+
+func readProcStat(pid int) (procStats, error) {
+	return procStats{}, errProcStats
+}
+
+func countOpenFiles(pid int) int {
+	return 0
+}
+
+func listPids() ([]int, error) {
+	return nil, errProcStats
+}
+
+var errProcStats = errors.New("Process stats unavailable on this platform")
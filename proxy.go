@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
 	"net/http/httputil"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
 var xipio = regexp.MustCompile("^(.*?)\\.?\\d+\\.\\d+\\.\\d+\\.\\d+\\.xip\\.io")
@@ -19,42 +23,232 @@ type AppCenter interface {
 	Get(string) (App, bool)
 }
 
+// processPorter is implemented by applications running several processes,
+// each one listening on its own port.
+type processPorter interface {
+	// ProcessPort returns the port of the named process, or of the
+	// process receiving the requests by default if the name is empty.
+	ProcessPort(string) (int, bool)
+
+	Processes() []ProcessInfo
+}
+
+// processSocketer is implemented by applications whose processes listen
+// on unix sockets instead of ports.
+type processSocketer interface {
+	// ProcessSocket returns the socket of the named process, or of the
+	// process receiving the requests by default if the name is empty.
+	ProcessSocket(string) (string, bool)
+}
+
 // Proxy is a ReverseProxy that takes an incoming request and
 // sends it to one of the known servers based on app's name,
 // after proxying the response back to the client.
 type Proxy struct {
 	httputil.ReverseProxy
-	ac  AppCenter
-	tld string
+	ac        AppCenter
+	tld       string
+	inspector *Inspector
+	accessLog *AccessLog
+	metrics   *Metrics
+
+	mu      sync.Mutex
+	sockets map[string]http.RoundTripper
 }
 
 func NewProxy(ac AppCenter, tld string) *Proxy {
-	p := &Proxy{ac: ac, tld: tld}
+	p := &Proxy{ac: ac, tld: tld, sockets: make(map[string]http.RoundTripper)}
 	p.Director = func(req *http.Request) {
 		req.URL.Scheme = "http"
+		rt, _ := req.Context().Value(routeKey{}).(*route)
+		if rt == nil {
+			rt = &route{}
+		}
+
 		app, found := p.resolve(req.Host)
-		if found && app.Running() {
-			req.URL.Host = fmt.Sprint("localhost:", app.Port())
-		} else {
+		if !found || !app.Running() {
 			req.URL.Host = fmt.Sprint("localhost:", ac.Port())
 			req.URL.Path = fmt.Sprintf("/apps/%s", p.appNameFromHost(req.Host))
+			rt.upstream, rt.port = req.URL.Host, ac.Port()
+			return
+		}
+
+		rt.app = app.Name()
+		if u, ok := unwrap(app).(upstreamer); ok {
+			rt.upstream = u.Upstream().String()
+			direct(req, u)
+		} else if socket, ok := p.socket(app, req.Host); ok {
+			rt.upstream = "unix://" + socket
+			direct(req, &socketUpstream{socket, p.socketTransport(socket)})
+		} else {
+			rt.port = p.port(app, req.Host)
+			req.URL.Host = fmt.Sprint("localhost:", rt.port)
+			rt.upstream = req.URL.Host
 		}
 	}
+	p.Transport = upstreamTransport{}
+	p.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Printf("http: proxy error: %v", err)
+		if rt, ok := r.Context().Value(routeKey{}).(*route); ok && rt.app != "" {
+			p.metrics.upstreamError(rt.app)
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}
 	return p
 }
 
+// Inspect records the requests to the applications, and their responses,
+// into i.
+func (p *Proxy) Inspect(i *Inspector) {
+	p.inspector = i
+	if i != nil {
+		i.proxy = p
+	}
+}
+
+// Log writes an entry to l for each request proxied.
+func (p *Proxy) Log(l *AccessLog) {
+	p.accessLog = l
+}
+
+// Measure records the requests proxied to each application into m.
+func (p *Proxy) Measure(m *Metrics) {
+	p.metrics = m
+}
+
+// route describes where the proxy sent a request.
+type route struct {
+	app      string
+	upstream string
+	port     int
+}
+
+// routeKey is the context key holding the route of a request.
+type routeKey struct{}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	uri := r.URL.RequestURI()
+	rt := &route{}
+	r = r.WithContext(context.WithValue(r.Context(), routeKey{}, rt))
+	sw := &statusWriter{ResponseWriter: w}
+
+	app, found := p.resolve(r.Host)
+	if found && p.inspector != nil && p.inspected(app) {
+		p.inspector.serve(app.Name(), &p.ReverseProxy, sw, r)
+	} else {
+		p.ReverseProxy.ServeHTTP(sw, r)
+	}
+
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+
+	elapsed := time.Since(start)
+	if rt.app != "" {
+		p.metrics.observe(rt.app, sw.status, elapsed)
+	}
+
+	p.accessLog.Log(&accessEntry{
+		Time:       start,
+		RemoteAddr: r.RemoteAddr,
+		Host:       r.Host,
+		App:        rt.app,
+		Upstream:   rt.upstream,
+		Port:       rt.port,
+		Method:     r.Method,
+		URI:        uri,
+		Proto:      r.Proto,
+		Status:     sw.status,
+		Bytes:      sw.bytes,
+		Duration:   elapsed.Seconds(),
+		Referer:    r.Referer(),
+		UserAgent:  r.UserAgent(),
+	})
+}
+
 func (p *Proxy) resolve(host string) (App, bool) {
 	name := p.appNameFromHost(host)
 	return p.ac.Get(name)
 }
 
+// inspected tells whether requests to app are recorded. Requests to the
+// command center, or falling back to it, are not: its pages carry the
+// CSRF token and its event streams never end.
+func (p *Proxy) inspected(app App) bool {
+	return app.Running() && app.Port() != p.ac.Port()
+}
+
+// processes describes the processes of app, if it has many.
+func processes(app App) []ProcessInfo {
+	if pp, ok := unwrap(app).(processPorter); ok {
+		return pp.Processes()
+	}
+	return nil
+}
+
+// port returns the port of the process named by the subdomain of host,
+// like worker.myapp.dev, falling back to the application's port.
+func (p *Proxy) port(app App, host string) int {
+	if pp, ok := unwrap(app).(processPorter); ok {
+		if port, ok := pp.ProcessPort(p.subdomainFromHost(host)); ok {
+			return port
+		}
+		if port, ok := pp.ProcessPort(""); ok {
+			return port
+		}
+	}
+	return app.Port()
+}
+
+// socket returns the unix socket of the process named by the subdomain of
+// host, falling back to the socket of the application's web process.
+func (p *Proxy) socket(app App, host string) (string, bool) {
+	ps, ok := unwrap(app).(processSocketer)
+	if !ok {
+		return "", false
+	}
+
+	if socket, ok := ps.ProcessSocket(p.subdomainFromHost(host)); ok {
+		return socket, true
+	}
+	return ps.ProcessSocket("")
+}
+
+// socketTransport returns the RoundTripper for socket, reusing its
+// connections across requests.
+func (p *Proxy) socketTransport(socket string) http.RoundTripper {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t, ok := p.sockets[socket]
+	if !ok {
+		t = newUnixTransport(socket)
+		p.sockets[socket] = t
+	}
+	return t
+}
+
 func (p *Proxy) appNameFromHost(host string) string {
+	t := p.hostLabels(host)
+	return t[len(t)-1]
+}
+
+// subdomainFromHost returns the label immediately before the app's name in host.
+func (p *Proxy) subdomainFromHost(host string) string {
+	t := p.hostLabels(host)
+	if len(t) < 2 {
+		return ""
+	}
+	return t[len(t)-2]
+}
+
+func (p *Proxy) hostLabels(host string) []string {
 	var prefix string
 	if xipio.MatchString(host) {
 		prefix = xipio.ReplaceAllString(host, "$1")
 	} else {
 		prefix = strings.TrimSuffix(host, "."+p.tld)
 	}
-	t := strings.Split(prefix, ".")
-	return t[len(t)-1]
+	return strings.Split(prefix, ".")
 }
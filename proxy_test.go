@@ -3,9 +3,12 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path"
 	"testing"
 )
 
@@ -139,6 +142,107 @@ func TestProxy(t *testing.T) {
 	}
 }
 
+func TestProxyProcesses(t *testing.T) {
+	createServer := func(content string) (*httptest.Server, int) {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, content)
+		}))
+		return s, getServerPort(t, s.URL)
+	}
+
+	web, webPort := createServer("web")
+	defer web.Close()
+	worker, workerPort := createServer("worker")
+	defer worker.Close()
+
+	a := &fakeProcessApp{ports: map[string]int{"web": webPort, "worker": workerPort}}
+	a.name = "myapp"
+	a.port = webPort
+
+	proxy := httptest.NewServer(NewProxy(newAppCenter([]App{a}), "local"))
+	defer proxy.Close()
+
+	tests := []struct {
+		host    string
+		content string
+	}{
+		{"myapp.local", "web"},
+		{"www.myapp.local", "web"},
+		{"worker.myapp.local", "worker"},
+		{"en.worker.myapp.local", "worker"},
+		{"worker.myapp.192.168.1.42.xip.io", "worker"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", proxy.URL, nil)
+		req.Host = tt.host
+		req.Close = true
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bodyBytes, _ := ioutil.ReadAll(res.Body)
+		if string(bodyBytes) != tt.content {
+			t.Errorf("%s: got %s; expected %s", tt.host, bodyBytes, tt.content)
+		}
+	}
+}
+
+func TestProxySockets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bam-sockets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sockets := make(map[string]string)
+	for _, name := range []string{"web", "worker"} {
+		content := name
+		sockets[name] = path.Join(dir, name+".sock")
+		l, err := net.Listen("unix", sockets[name])
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, content)
+		}))
+	}
+	sockets[""] = sockets["web"]
+
+	a := &fakeSocketApp{sockets: sockets}
+	a.name = "myapp"
+
+	proxy := httptest.NewServer(NewProxy(newAppCenter([]App{a}), "local"))
+	defer proxy.Close()
+
+	tests := []struct {
+		host    string
+		content string
+	}{
+		{"myapp.local", "web"},
+		{"www.myapp.local", "web"},
+		{"worker.myapp.local", "worker"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", proxy.URL, nil)
+		req.Host = tt.host
+		req.Close = true
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bodyBytes, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if string(bodyBytes) != tt.content {
+			t.Errorf("%s: got %s; expected %s", tt.host, bodyBytes, tt.content)
+		}
+	}
+}
+
 func getServerPort(t *testing.T, baseURL string) int {
 	url, e := url.Parse(baseURL)
 	if e != nil {
@@ -159,6 +263,29 @@ type fakeApp struct {
 func (a *fakeApp) Start() error  { return nil }
 func (a *fakeApp) Stop() error   { return nil }
 func (a *fakeApp) Running() bool { return true }
+func (a *fakeApp) State() State  { return Running }
+
+type fakeProcessApp struct {
+	fakeApp
+	ports map[string]int
+}
+
+func (a *fakeProcessApp) ProcessPort(name string) (int, bool) {
+	port, ok := a.ports[name]
+	return port, ok
+}
+
+func (a *fakeProcessApp) Processes() []ProcessInfo { return nil }
+
+type fakeSocketApp struct {
+	fakeApp
+	sockets map[string]string
+}
+
+func (a *fakeSocketApp) ProcessSocket(name string) (string, bool) {
+	socket, ok := a.sockets[name]
+	return socket, ok
+}
 
 type fakeAppCenter struct {
 	fakeApp
@@ -2,12 +2,97 @@ var searchBox = document.getElementById('search-box');
 var apps = document.querySelectorAll('li[data-app]');
 
 function search() {
-  var node, name;
+  if (!searchBox) {
+    return;
+  }
+
+  var node, text;
   for (var i = 0; i < apps.length; i++) {
     node = apps[i];
-    name = node.attributes['data-app'].value;
-    node.classList.toggle('hide', name.search(searchBox.value) < 0);
+    text = node.attributes['data-app'].value;
+    if (node.attributes['data-tags']) {
+      text += ' ' + node.attributes['data-tags'].value;
+    }
+    node.classList.toggle('hide', text.search(searchBox.value) < 0);
+  }
+
+  // groups whose applications are all hidden are hidden too
+  var groups = document.querySelectorAll('[data-group]');
+  for (var j = 0; j < groups.length; j++) {
+    var shown = groups[j].querySelectorAll('li[data-app]:not(.hide)');
+    groups[j].classList.toggle('hide', shown.length === 0);
+  }
+}
+
+// refresh replaces every live section of the page with its current version.
+function refresh() {
+  var xhr = new XMLHttpRequest();
+  xhr.open('GET', location.href);
+  xhr.responseType = 'document';
+  xhr.onload = function() {
+    var fresh = xhr.response.querySelectorAll('[data-live]');
+    var live = document.querySelectorAll('[data-live]');
+    for (var i = 0; i < live.length && i < fresh.length; i++) {
+      live[i].innerHTML = fresh[i].innerHTML;
+    }
+    apps = document.querySelectorAll('li[data-app]');
+    search();
+  };
+  xhr.send();
+}
+
+// Actions are sent in the background, along with the CSRF token, and the
+// page is refreshed once they're done. Errors replace the page.
+function submitAction(event) {
+  var form = event.target;
+  if (!form.classList || !form.classList.contains('action')) {
+    return;
+  }
+  event.preventDefault();
+
+  var token = document.querySelector('meta[name="csrf-token"]');
+  var xhr = new XMLHttpRequest();
+  xhr.open('POST', form.action);
+  if (token) {
+    xhr.setRequestHeader('X-CSRF-Token', token.content);
+  }
+  xhr.onload = function() {
+    if (xhr.status >= 400) {
+      document.open();
+      document.write(xhr.responseText);
+      document.close();
+      return;
+    }
+    refresh();
+  };
+  xhr.send(new FormData(form));
+}
+
+function listen() {
+  if (typeof EventSource === 'undefined' || typeof eventsURL === 'undefined') {
+    return;
+  }
+
+  var live = document.querySelector('[data-live]');
+  if (!live) {
+    return;
+  }
+
+  var app = live.attributes['data-app'];
+  var url = eventsURL + (app ? '?app=' + encodeURIComponent(app.value) : '');
+  var source = new EventSource(url);
+  var types = ['registered', 'starting', 'ready', 'stopped', 'crashed', 'down', 'shared', 'unshared'];
+  for (var i = 0; i < types.length; i++) {
+    source.addEventListener(types[i], refresh);
   }
 }
 
 search();
+listen();
+document.addEventListener('submit', submitAction);
+
+// Resource usage is sampled in the background, so pages showing it are
+// refreshed periodically.
+if (document.querySelector('[data-usage]')) {
+  setInterval(refresh, 5000);
+}
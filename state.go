@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// stateFile is the file, inside bam's data directory, where the running
+// applications are kept, so that they can be restored on startup.
+const stateFile = "state.json"
+
+// AppState is the state of a running application: whether it's shared,
+// and the port of each of its processes.
+type AppState struct {
+	Shared bool           `json:"shared,omitempty"`
+	Ports  map[string]int `json:"ports,omitempty"`
+}
+
+// stateStore keeps the running applications in a file. Once frozen, the
+// file isn't changed anymore, which keeps the applications stopped on
+// shutdown as running. A nil stateStore keeps nothing.
+type stateStore struct {
+	mu     sync.Mutex
+	file   string
+	frozen bool
+}
+
+func newStateStore(dir string) *stateStore {
+	if dir == "" {
+		return nil
+	}
+	return &stateStore{file: path.Join(dir, stateFile)}
+}
+
+// Load returns the state of the applications running when it was saved,
+// by name.
+func (s *stateStore) Load() map[string]AppState {
+	state := make(map[string]AppState)
+	if s == nil {
+		return state
+	}
+
+	b, err := ioutil.ReadFile(s.file)
+	if err != nil {
+		return state
+	}
+
+	err = json.Unmarshal(b, &state)
+	if err != nil {
+		log.Printf("WARN ignoring invalid state file %s: %v\n", s.file, err)
+	}
+	return state
+}
+
+// Save writes the state of the running applications.
+func (s *stateStore) Save(apps []*ShareableApp) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.frozen {
+		return
+	}
+
+	state := make(map[string]AppState)
+	for _, a := range apps {
+		if a.Running() {
+			state[strings.ToLower(a.Name())] = AppState{Shared: a.Shared(), Ports: appPorts(a)}
+		}
+	}
+
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(path.Dir(s.file), 0755)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(s.file, b, 0644)
+	}
+	if err != nil {
+		log.Printf("ERROR: unable to save state file %s: %v\n", s.file, err)
+	}
+}
+
+// Freeze saves the state of apps for the last time.
+func (s *stateStore) Freeze(apps []*ShareableApp) {
+	s.Save(apps)
+	if s != nil {
+		s.mu.Lock()
+		s.frozen = true
+		s.mu.Unlock()
+	}
+}
+
+// appPorts returns the ports allocated to the processes of a, by process
+// name, or the port allocated to a under an empty name.
+func appPorts(a App) map[string]int {
+	ports := make(map[string]int)
+	switch u := unwrap(a).(type) {
+	case processPorter:
+		for _, p := range u.Processes() {
+			for _, i := range p.Instances {
+				if i.Port > 0 {
+					ports[i.Name] = i.Port
+				}
+			}
+		}
+	case *webApp:
+		ports[""] = u.Port()
+	}
+	return ports
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStateRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bam-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &Config{AppsDir: "./examples/", Tld: "app", DataDir: dir}
+	cc := NewCommandCenter("bam", c)
+	go cc.Start()
+	<-time.After(200 * time.Millisecond) // wait for command center to start
+
+	static, _ := cc.app("static")
+	if err := cc.start(static); err != nil {
+		t.Fatal(err)
+	}
+	port := static.Port()
+
+	var state map[string]AppState
+	for i := 0; i < 20 && state["static"].Ports[""] != port; i++ {
+		<-time.After(50 * time.Millisecond) // wait for the state to be saved
+		state = cc.state.Load()
+	}
+
+	if len(state) != 1 || state["static"].Ports[""] != port {
+		t.Fatalf("State: got %v; expected static on port %d", state, port)
+	}
+
+	cc.Stop()
+	if state := cc.state.Load(); len(state) != 1 {
+		t.Errorf("State: got %v; applications stopped on shutdown should be kept", state)
+	}
+
+	c.Restore = true
+	c.AutoStart = []interface{}{"static"}
+	restored := NewCommandCenter("bam", c)
+	go restored.Start()
+	defer restored.Stop()
+
+	static, _ = restored.app("static")
+	for i := 0; i < 20 && !static.Running(); i++ {
+		<-time.After(50 * time.Millisecond) // wait for static to be restored
+	}
+
+	if !static.Running() || static.Port() != port {
+		t.Errorf("Restored static: running %v on port %d; expected port %d", static.Running(), static.Port(), port)
+	}
+
+	if ping, _ := restored.app("ping"); ping.Running() {
+		t.Errorf("Only the applications which were running should be restored")
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// precompressed lists the encodings of precompressed files, by preference.
+var precompressed = []struct {
+	encoding  string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// staticHandler serves the files of a static site as set by its
+// StaticConfig.
+type staticHandler struct {
+	root       http.Dir
+	fileServer http.Handler
+	config     StaticConfig
+	reload     *liveReload
+}
+
+func newStaticHandler(root string, c StaticConfig) *staticHandler {
+	h := &staticHandler{
+		root:       http.Dir(root),
+		fileServer: http.FileServer(http.Dir(root)),
+		config:     c,
+	}
+	if c.LiveReload {
+		h.reload = newLiveReload(root)
+	}
+	return h
+}
+
+func (h *staticHandler) watch() {
+	if h.reload != nil {
+		h.reload.watch()
+	}
+}
+
+func (h *staticHandler) unwatch() {
+	if h.reload != nil {
+		h.reload.unwatch()
+	}
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.reload != nil && strings.HasPrefix(r.URL.Path, liveReloadPath) {
+		h.reload.ServeHTTP(w, r)
+		return
+	}
+
+	name := path.Clean("/" + r.URL.Path)
+	info, err := h.stat(name)
+	if err == nil && info.IsDir() {
+		index := path.Join(name, "index.html")
+		if ii, ierr := h.stat(index); ierr == nil && !ii.IsDir() {
+			if !strings.HasSuffix(r.URL.Path, "/") {
+				http.Redirect(w, r, path.Base(r.URL.Path)+"/", http.StatusMovedPermanently)
+				return
+			}
+			name, info = index, ii
+		} else if h.config.listing() {
+			h.fileServer.ServeHTTP(w, r)
+			return
+		} else {
+			err = os.ErrNotExist
+		}
+	}
+
+	if err != nil {
+		h.notFound(w, r)
+		return
+	}
+	h.serveFile(w, r, name)
+}
+
+func (h *staticHandler) stat(name string) (os.FileInfo, error) {
+	f, err := h.root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// notFound serves index.html to single page applications, or the custom
+// 404 page, if any.
+func (h *staticHandler) notFound(w http.ResponseWriter, r *http.Request) {
+	if h.config.SPA && (r.Method == "GET" || r.Method == "HEAD") {
+		if info, err := h.stat("/index.html"); err == nil && !info.IsDir() {
+			h.serveFile(w, r, "/index.html")
+			return
+		}
+	}
+
+	if h.config.NotFound == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := h.root.Open(path.Clean("/" + h.config.NotFound))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", contentType(h.config.NotFound))
+	w.WriteHeader(http.StatusNotFound)
+	io.Copy(w, f)
+}
+
+// serveFile serves the named file, or its precompressed version if the
+// client accepts it, with the configured caching headers. HTML pages of
+// live reloading sites get the reload script.
+func (h *staticHandler) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	if h.reload != nil && isHTML(name) {
+		h.serveLiveReload(w, r, name)
+		return
+	}
+
+	f, encoding, err := h.open(name, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	header := w.Header()
+	if h.config.CacheControl != "" {
+		header.Set("Cache-Control", h.config.CacheControl)
+	}
+
+	if h.config.ETag {
+		header.Set("Etag", etag(info, encoding))
+	}
+
+	if h.config.Precompressed {
+		header.Add("Vary", "Accept-Encoding")
+	}
+
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+		header.Set("Content-Type", contentType(name))
+	}
+
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// serveLiveReload serves the named HTML page with the reload script.
+func (h *staticHandler) serveLiveReload(w http.ResponseWriter, r *http.Request, name string) {
+	f, err := h.root.Open(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err == nil {
+		var b []byte
+		b, err = ioutil.ReadAll(f)
+		if err == nil {
+			w.Header().Set("Cache-Control", "no-cache")
+			http.ServeContent(w, r, name, info.ModTime(), bytes.NewReader(injectLiveReload(b)))
+			return
+		}
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func isHTML(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".html" || ext == ".htm"
+}
+
+// open opens the named file, preferring a precompressed version accepted
+// by the client. It returns the encoding of the opened file.
+func (h *staticHandler) open(name string, r *http.Request) (http.File, string, error) {
+	if h.config.Precompressed {
+		for _, p := range precompressed {
+			if !acceptsEncoding(r, p.encoding) {
+				continue
+			}
+
+			f, err := h.root.Open(name + p.extension)
+			if err == nil {
+				return f, p.encoding, nil
+			}
+		}
+	}
+
+	f, err := h.root.Open(name)
+	return f, "", err
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header of r
+// includes encoding.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, e := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(e, ";")
+		if strings.TrimSpace(parts[0]) != encoding {
+			continue
+		}
+
+		if len(parts) > 1 && strings.Replace(parts[1], " ", "", -1) == "q=0" {
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// etag builds a weak validator from the size and modification time of a
+// file and its encoding.
+func etag(info os.FileInfo, encoding string) string {
+	tag := fmt.Sprintf("%x-%x", info.Size(), info.ModTime().UnixNano())
+	if encoding != "" {
+		tag += "-" + encoding
+	}
+	return fmt.Sprintf("W/%q", tag)
+}
+
+func contentType(name string) string {
+	t := mime.TypeByExtension(path.Ext(name))
+	if t == "" {
+		t = "application/octet-stream"
+	}
+	return t
+}
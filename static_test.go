@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func serveStatic(h http.Handler, target string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestStaticRoot(t *testing.T) {
+	dir := newTestDir(t, map[string]string{
+		".bam.toml":       "[static]\nroot = \"dist\"\n",
+		"dist/index.html": "dist",
+		"index.html":      "top",
+	})
+	defer os.RemoveAll(dir)
+
+	a, err := NewWebServerApp(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := serveStatic(a.(*webApp).handler, "/", nil)
+	if w.Body.String() != "dist" {
+		t.Errorf("Body: got %s; expected dist", w.Body)
+	}
+}
+
+func TestStaticSPA(t *testing.T) {
+	dir := newTestDir(t, map[string]string{"index.html": "app", "app.js": "js"})
+	defer os.RemoveAll(dir)
+
+	h := newStaticHandler(dir, StaticConfig{SPA: true})
+	tests := []struct {
+		target string
+		body   string
+	}{
+		{"/", "app"},
+		{"/app.js", "js"},
+		{"/users/42", "app"},
+	}
+
+	for _, tt := range tests {
+		w := serveStatic(h, tt.target, nil)
+		if w.Code != http.StatusOK || w.Body.String() != tt.body {
+			t.Errorf("%s: got %d %s; expected 200 %s", tt.target, w.Code, w.Body, tt.body)
+		}
+	}
+}
+
+func TestStaticListing(t *testing.T) {
+	dir := newTestDir(t, map[string]string{"docs/a.txt": "a", "404.html": "missing"})
+	defer os.RemoveAll(dir)
+
+	w := serveStatic(newStaticHandler(dir, StaticConfig{}), "/docs/", nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("Listing: got %d; expected %d", w.Code, http.StatusOK)
+	}
+
+	listing := false
+	h := newStaticHandler(dir, StaticConfig{Listing: &listing, NotFound: "404.html"})
+	for _, target := range []string{"/docs/", "/nothing"} {
+		w = serveStatic(h, target, nil)
+		if w.Code != http.StatusNotFound || w.Body.String() != "missing" {
+			t.Errorf("%s: got %d %s; expected 404 missing", target, w.Code, w.Body)
+		}
+	}
+
+	w = serveStatic(h, "/docs/a.txt", nil)
+	if w.Body.String() != "a" {
+		t.Errorf("File: got %s; expected a", w.Body)
+	}
+}
+
+func TestStaticCaching(t *testing.T) {
+	dir := newTestDir(t, map[string]string{"app.css": "body {}"})
+	defer os.RemoveAll(dir)
+
+	h := newStaticHandler(dir, StaticConfig{CacheControl: "public, max-age=60", ETag: true})
+	w := serveStatic(h, "/app.css", nil)
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=60" {
+		t.Errorf("Cache-Control: got %q", cc)
+	}
+
+	tag := w.Header().Get("Etag")
+	if tag == "" {
+		t.Fatal("Etag not set")
+	}
+
+	w = serveStatic(h, "/app.css", map[string]string{"If-None-Match": tag})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Status code: got %d; expected %d", w.Code, http.StatusNotModified)
+	}
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	dir := newTestDir(t, map[string]string{
+		"app.js":    "plain",
+		"app.js.gz": "gzipped",
+		"app.js.br": "brotli",
+	})
+	defer os.RemoveAll(dir)
+
+	h := newStaticHandler(dir, StaticConfig{Precompressed: true})
+	tests := []struct {
+		accept   string
+		encoding string
+		body     string
+	}{
+		{"", "", "plain"},
+		{"gzip, deflate", "gzip", "gzipped"},
+		{"gzip, br", "br", "brotli"},
+		{"br;q=0, gzip", "gzip", "gzipped"},
+	}
+
+	for _, tt := range tests {
+		w := serveStatic(h, "/app.js", map[string]string{"Accept-Encoding": tt.accept})
+		if w.Header().Get("Content-Encoding") != tt.encoding || w.Body.String() != tt.body {
+			t.Errorf("%q: got %q %s; expected %q %s", tt.accept,
+				w.Header().Get("Content-Encoding"), w.Body, tt.encoding, tt.body)
+		}
+
+		if ct := w.Header().Get("Content-Type"); ct != "application/javascript" && ct != "text/javascript; charset=utf-8" {
+			t.Errorf("%q: unexpected Content-Type %s", tt.accept, ct)
+		}
+	}
+}
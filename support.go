@@ -1,7 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"net"
+	"os"
+	"path"
 	"strconv"
 )
 
@@ -19,7 +22,9 @@ func AddrPort(addr string) (int, error) {
 	return port, nil
 }
 
-// FreePort returns an unused port.
+// FreePort returns an unused port. The port is free when FreePort returns,
+// but nothing prevents other processes from binding it before the caller
+// does; use a PortAllocator to avoid handing out the same port twice.
 func FreePort() (int, error) {
 	l, err := NewLocalListener()
 	if err != nil {
@@ -45,3 +50,22 @@ func NewLocalListener() (net.Listener, error) {
 	}
 	return l, nil
 }
+
+// socketDir returns the directory holding the unix sockets of the
+// applications: $XDG_RUNTIME_DIR/bam, or a per-user temporary directory.
+func socketDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return path.Join(dir, programName)
+	}
+	return path.Join(os.TempDir(), fmt.Sprintf("%s-%d", programName, os.Getuid()))
+}
+
+// defaultDataDir returns the directory where bam keeps its state,
+// following the XDG Base Directory Specification.
+func defaultDataDir() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		dir = path.Join(os.Getenv("HOME"), ".local", "share")
+	}
+	return path.Join(dir, programName)
+}
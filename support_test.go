@@ -1,6 +1,11 @@
 package main
 
-import "testing"
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
 
 func TestAddrPort(t *testing.T) {
 	tests := []struct {
@@ -19,3 +24,23 @@ func TestAddrPort(t *testing.T) {
 		}
 	}
 }
+
+// newTestDir creates a temporary directory holding files, given by their
+// paths relative to it, and returns its path.
+func newTestDir(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "bam")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		file := path.Join(dir, name)
+		if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// upstreamer is implemented by applications whose requests are not sent
+// to a port on the local host, but to another host or to a unix socket.
+type upstreamer interface {
+	// Upstream returns the address of the application, like
+	// https://staging-api.example.com or unix:///tmp/app.sock.
+	Upstream() *url.URL
+
+	// Transport returns the RoundTripper used to reach the upstream.
+	Transport() http.RoundTripper
+}
+
+// parseUpstream parses the address of an upstream, which must be an
+// absolute http, https or unix URL.
+func parseUpstream(rawurl string) (*url.URL, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return nil, fmt.Errorf("Invalid upstream %s: missing host", rawurl)
+		}
+	case "unix":
+		if u.Path == "" {
+			return nil, fmt.Errorf("Invalid upstream %s: missing socket path", rawurl)
+		}
+	default:
+		return nil, fmt.Errorf("Invalid upstream %s: unsupported scheme %s", rawurl, u.Scheme)
+	}
+	return u, nil
+}
+
+// newUpstreamTransport returns a RoundTripper for u. TLS certificates
+// aren't verified if skipVerify is set.
+func newUpstreamTransport(u *url.URL, skipVerify bool) http.RoundTripper {
+	switch {
+	case u.Scheme == "unix":
+		return newUnixTransport(u.Path)
+	case skipVerify:
+		return &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	default:
+		return http.DefaultTransport
+	}
+}
+
+// newUnixTransport returns a RoundTripper sending all requests to the
+// unix socket at path.
+func newUnixTransport(path string) http.RoundTripper {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}
+}
+
+// upstreamAddr returns the network address of u, to be used by net.Dial.
+func upstreamAddr(u *url.URL) (network, address string) {
+	if u.Scheme == "unix" {
+		return "unix", u.Path
+	}
+
+	if u.Port() != "" {
+		return "tcp", u.Host
+	}
+
+	port := "80"
+	if u.Scheme == "https" {
+		port = "443"
+	}
+	return "tcp", net.JoinHostPort(u.Hostname(), port)
+}
+
+// appSocket returns the unix socket of the web process of a, if it
+// listens on a socket.
+func appSocket(a App) (string, bool) {
+	if ps, ok := unwrap(a).(processSocketer); ok {
+		return ps.ProcessSocket("")
+	}
+	return "", false
+}
+
+// appAddr returns the network address where a accepts connections.
+func appAddr(a App) (network, address string) {
+	if u, ok := unwrap(a).(upstreamer); ok {
+		return upstreamAddr(u.Upstream())
+	}
+	if socket, ok := appSocket(a); ok {
+		return "unix", socket
+	}
+	return "tcp", fmt.Sprintf("localhost:%d", a.Port())
+}
+
+// socketUpstream is the upstream of a process listening on a unix socket.
+type socketUpstream struct {
+	socket    string
+	transport http.RoundTripper
+}
+
+func (s *socketUpstream) Upstream() *url.URL {
+	return &url.URL{Scheme: "unix", Path: s.socket}
+}
+
+func (s *socketUpstream) Transport() http.RoundTripper {
+	return s.transport
+}
+
+// transportKey is the context key holding the RoundTripper chosen by
+// the proxy for a request.
+type transportKey struct{}
+
+// upstreamTransport sends requests through the RoundTripper stored in
+// their context, or through the default transport.
+type upstreamTransport struct{}
+
+func (upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t, ok := req.Context().Value(transportKey{}).(http.RoundTripper); ok {
+		return t.RoundTrip(req)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// direct points req to the upstream of u.
+func direct(req *http.Request, u upstreamer) {
+	target := u.Upstream()
+	if target.Scheme == "unix" {
+		req.URL.Scheme = "http"
+		req.URL.Host = "localhost"
+	} else {
+		req.URL.Scheme = target.Scheme
+		req.URL.Host = target.Host
+		req.URL.Path = joinPath(target.Path, req.URL.Path)
+		req.Host = target.Host
+	}
+
+	*req = *req.WithContext(context.WithValue(req.Context(), transportKey{}, u.Transport()))
+}
+
+func joinPath(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case strings.HasSuffix(a, "/") && strings.HasPrefix(b, "/"):
+		return a + b[1:]
+	case !strings.HasSuffix(a, "/") && !strings.HasPrefix(b, "/"):
+		return a + "/" + b
+	}
+	return a + b
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestParseUpstream(t *testing.T) {
+	tests := []struct {
+		rawurl string
+		valid  bool
+	}{
+		{"http://10.0.0.5:8080", true},
+		{"https://staging-api.example.com/v1", true},
+		{"unix:///tmp/app.sock", true},
+		{"http://", false},
+		{"unix://", false},
+		{"ftp://example.com", false},
+		{"localhost:8080", false},
+	}
+
+	for _, tt := range tests {
+		_, err := parseUpstream(tt.rawurl)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: got error %v; expected valid %v", tt.rawurl, err, tt.valid)
+		}
+	}
+}
+
+func TestUpstreamAddr(t *testing.T) {
+	tests := []struct {
+		rawurl  string
+		network string
+		address string
+	}{
+		{"http://10.0.0.5:8080", "tcp", "10.0.0.5:8080"},
+		{"http://example.com", "tcp", "example.com:80"},
+		{"https://example.com/api", "tcp", "example.com:443"},
+		{"unix:///tmp/app.sock", "unix", "/tmp/app.sock"},
+	}
+
+	for _, tt := range tests {
+		u, _ := parseUpstream(tt.rawurl)
+		network, address := upstreamAddr(u)
+		if network != tt.network || address != tt.address {
+			t.Errorf("%s: got %s %s; expected %s %s", tt.rawurl, network, address, tt.network, tt.address)
+		}
+	}
+}
+
+func TestNewAlias(t *testing.T) {
+	var c Config
+	_, err := toml.Decode(`
+[aliases]
+btsync = 8888
+vm = "http://192.168.56.10:3000"
+staging = { url = "https://staging.example.com", skip_verify = true }
+broken = "ftp://example.com"
+`, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := newAlias("btsync", c.Aliases["btsync"])
+	if err != nil || a.Port() != 8888 {
+		t.Errorf("btsync: got %v, %v; expected port 8888", a, err)
+	}
+
+	for _, name := range []string{"vm", "staging"} {
+		a, err := newAlias(name, c.Aliases[name])
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, ok := a.(upstreamer); !ok {
+			t.Errorf("%s: expected an upstream alias", name)
+		}
+	}
+
+	staging, _ := newAlias("staging", c.Aliases["staging"])
+	tr, ok := staging.(upstreamer).Transport().(*http.Transport)
+	if !ok || !tr.TLSClientConfig.InsecureSkipVerify {
+		t.Errorf("staging: expected TLS verification to be skipped")
+	}
+
+	_, err = newAlias("broken", c.Aliases["broken"])
+	if err == nil {
+		t.Errorf("broken: expected an error")
+	}
+}
+
+func TestProxyUpstreams(t *testing.T) {
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "remote %s %s", r.Host, r.URL.Path)
+	}))
+	defer remote.Close()
+
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "secure %s", r.URL.Path)
+	}))
+	defer secure.Close()
+
+	dir, err := ioutil.TempDir("", "bam-upstream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := path.Join(dir, "app.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "socket %s", r.URL.Path)
+	}))
+	defer l.Close()
+
+	newUpstream := func(name, rawurl string, skipVerify bool) App {
+		a, err := NewUpstreamApp(name, rawurl, skipVerify)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+
+	apps := []App{
+		newUpstream("remote", remote.URL+"/base", false),
+		newUpstream("secure", secure.URL, true),
+		newUpstream("socket", "unix://"+socket, false),
+	}
+	proxy := httptest.NewServer(NewProxy(newAppCenter(apps), "local"))
+	defer proxy.Close()
+
+	tests := []struct {
+		host    string
+		content string
+	}{
+		{"remote.local", fmt.Sprintf("remote %s /base/hello", remote.Listener.Addr())},
+		{"secure.local", "secure /hello"},
+		{"socket.local", "socket /hello"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", proxy.URL+"/hello", nil)
+		req.Host = tt.host
+		req.Close = true
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bodyBytes, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if string(bodyBytes) != tt.content {
+			t.Errorf("%s: got %s; expected %s", tt.host, bodyBytes, tt.content)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// usageInterval is how often the resource usage of the applications is
+// sampled.
+var usageInterval = 5 * time.Second
+
+// processOwner is implemented by applications running processes of their
+// own, as opposed to aliases or applications served by BAM! itself.
+type processOwner interface {
+	// Pids returns the ids of the processes started by the application,
+	// each one leading its own process group.
+	Pids() []int
+}
+
+// Usage is the resource usage of all processes of an application,
+// including their children.
+type Usage struct {
+	App       string    `json:"app"`
+	CPU       float64   `json:"cpu_percent"`
+	RSS       int64     `json:"rss_bytes"`
+	OpenFiles int       `json:"open_files"`
+	Processes int       `json:"processes"`
+	Started   time.Time `json:"started"`
+	Uptime    float64   `json:"uptime_seconds"`
+}
+
+// cpuSample is the CPU time used by an application at a given time.
+type cpuSample struct {
+	cpu time.Duration
+	at  time.Time
+}
+
+// usageSampler periodically samples the resource usage of the running
+// applications.
+type usageSampler struct {
+	mu    sync.RWMutex
+	apps  func() []*ShareableApp
+	usage map[string]*Usage
+	last  map[string]cpuSample
+}
+
+func newUsageSampler(apps func() []*ShareableApp) *usageSampler {
+	return &usageSampler{
+		apps:  apps,
+		usage: make(map[string]*Usage),
+		last:  make(map[string]cpuSample),
+	}
+}
+
+// Run samples the resource usage every interval.
+func (s *usageSampler) Run(interval time.Duration) {
+	for {
+		s.sample()
+		<-time.After(interval)
+	}
+}
+
+func (s *usageSampler) sample() {
+	usage := make(map[string]*Usage)
+	last := make(map[string]cpuSample)
+
+	s.mu.RLock()
+	previous := s.last
+	s.mu.RUnlock()
+
+	var all map[int]procStats
+	for _, app := range s.apps() {
+		o, ok := unwrap(app).(processOwner)
+		if !ok || !app.Running() {
+			continue
+		}
+
+		if all == nil {
+			all = readProcTable()
+		}
+
+		key := strings.ToLower(app.Name())
+		u, cpu := measure(app.Name(), o.Pids(), all)
+		now := time.Now()
+		if p, ok := previous[key]; ok && now.After(p.at) {
+			u.CPU = percent(cpu-p.cpu, now.Sub(p.at))
+		} else if !u.Started.IsZero() {
+			u.CPU = percent(cpu, now.Sub(u.Started))
+		}
+
+		usage[key] = u
+		last[key] = cpuSample{cpu, now}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage = usage
+	s.last = last
+}
+
+// measure sums the resource usage of the process trees led by pids among
+// all processes, returning it along with the CPU time they used.
+func measure(app string, pids []int, all map[int]procStats) (*Usage, time.Duration) {
+	u := &Usage{App: app}
+	tree := processTree(pids, all)
+	for _, pid := range pids {
+		if s, ok := tree[pid]; ok && !s.StartTime.IsZero() {
+			if u.Started.IsZero() || s.StartTime.Before(u.Started) {
+				u.Started = s.StartTime
+			}
+		}
+	}
+
+	var cpu time.Duration
+	for _, s := range tree {
+		cpu += s.CPU
+		u.RSS += s.RSS
+		u.OpenFiles += s.OpenFiles
+		u.Processes++
+	}
+
+	if !u.Started.IsZero() {
+		u.Uptime = time.Since(u.Started).Seconds()
+	}
+	return u, cpu
+}
+
+// percent returns the share of elapsed time spent as cpu time, where
+// 100 is a whole CPU core. Processes which exited make cpu negative.
+func percent(cpu, elapsed time.Duration) float64 {
+	if cpu < 0 || elapsed <= 0 {
+		return 0
+	}
+	return float64(cpu) / float64(elapsed) * 100
+}
+
+// formatBytes formats n bytes using binary units, like 12.5 MiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatUptime formats seconds as a duration, like 2h5m3s.
+func formatUptime(seconds float64) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+// Usage returns the last resource usage sampled for app, or nil.
+func (s *usageSampler) Usage(app string) *Usage {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.usage[strings.ToLower(app)]
+}
+
+// All returns the last resource usage sampled for every running
+// application, sorted by name.
+func (s *usageSampler) All() []*Usage {
+	all := []*Usage{}
+	for _, app := range s.apps() {
+		if u := s.Usage(app.Name()); u != nil {
+			all = append(all, u)
+		}
+	}
+	return all
+}
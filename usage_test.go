@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n        int64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KiB"},
+		{25 * 1024 * 1024, "25.0 MiB"},
+		{3 * 1024 * 1024 * 1024, "3.0 GiB"},
+	}
+
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.expected {
+			t.Errorf("%d: got %s; expected %s", tt.n, got, tt.expected)
+		}
+	}
+}
+
+func TestUsage(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process stats are only read on Linux")
+	}
+
+	a, dir := newTestProcessApp(t, map[string]string{
+		"Procfile": "web: sleep 10 & sleep 10 & wait\nworker: sleep 10\n",
+	})
+	defer os.RemoveAll(dir)
+
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Stop()
+
+	<-time.After(200 * time.Millisecond) // let the shells start their children
+
+	pids := a.(processOwner).Pids()
+	if len(pids) != 2 {
+		t.Fatalf("Pids: got %v; expected 2 processes", pids)
+	}
+
+	cc := NewCommandCenter("bam", &Config{Tld: "app"})
+	cc.register(a)
+	cc.usage.sample()
+
+	u := cc.usage.Usage(a.Name())
+	if u == nil {
+		t.Fatalf("Usage of %s not sampled", a.Name())
+	}
+
+	// web runs a shell and its 2 sleeps, while worker's shell runs sleep itself
+	if u.Processes < 4 || u.RSS <= 0 || u.OpenFiles <= 0 {
+		t.Errorf("Usage: got %+v", u)
+	}
+
+	if u.Started.IsZero() || u.Uptime < 0 || u.Uptime > 60 {
+		t.Errorf("Uptime: got %v since %s", u.Uptime, u.Started)
+	}
+
+	w := httptest.NewRecorder()
+	cc.handler.ServeHTTP(w, httptest.NewRequest("GET", "/usage", nil))
+	var all []*Usage
+	if err := json.Unmarshal(w.Body.Bytes(), &all); err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].App != a.Name() || all[0].Processes != u.Processes {
+		t.Errorf("Usage API: got %s", w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	cc.handler.ServeHTTP(w, httptest.NewRequest("GET", "/apps/"+a.Name(), nil))
+	if !strings.Contains(w.Body.String(), "<th>Memory</th>") {
+		t.Errorf("App page should show the resource usage")
+	}
+
+	a.Stop()
+	cc.usage.sample()
+	w = httptest.NewRecorder()
+	cc.handler.ServeHTTP(w, httptest.NewRequest("GET", "/apps/"+a.Name()+"/usage", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Status code: got %d; expected %d", w.Code, http.StatusNotFound)
+	}
+}